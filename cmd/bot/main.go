@@ -1,102 +1,271 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
-	"sync"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/danielholmes839/ocua-attendance-bot/internal/bot"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/config"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/history"
 	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
 	"github.com/joho/godotenv"
 	"github.com/playwright-community/playwright-go"
-	"gopkg.in/yaml.v2"
 )
 
-func launch() error {
+// launch runs the bot until ctx is cancelled
+func launch(ctx context.Context, configPath string) error {
 	godotenv.Load()
 
-	// ocua environment variables
-	username := os.Getenv("ocua_username")
-	password := os.Getenv("ocua_password")
-	teamID := os.Getenv("ocua_team_id")
-	baseURL := os.Getenv("ocua_base_url")
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
 
-	// discord environment variables
-	guildID := os.Getenv("discord_guild_id")
-	applicationID := os.Getenv("discord_application_id")
-	token := os.Getenv("discord_bot_token")
+	// setup logger
+	logger := cfg.Logging.Logger(os.Stdout)
+	slog.SetDefault(logger)
 
-	data, err := os.ReadFile("./data/players.yaml")
+	// optional encrypted session cookies so restarts don't log in again
+	var store *ocua.CookieStore
+	key, err := cfg.OCUA.DecodeSessionKey()
 	if err != nil {
 		return err
 	}
+	if key != nil {
+		store = &ocua.CookieStore{Path: cfg.OCUA.SessionPath, Key: key}
+	}
+
+	// dm an admin when logging in keeps failing, including while the bot is
+	// waiting for its first login
+	alerts := &bot.AdminAlerts{
+		AdminID: cfg.Alerts.AdminID,
+		After:   cfg.Alerts.AfterFailures,
+	}
+	if cfg.Alerts.AdminID != "" {
+		err = alerts.Connect(cfg.Discord.BotToken)
+		if err != nil {
+			return err
+		}
+	}
 
-	players := map[string]string{}
-	yaml.Unmarshal(data, players)
+	var client ocua.API
+	if cfg.OCUA.Client == "http" {
+		// plain http client, no browser required
+		httpClient := &ocua.HTTPClient{
+			BaseURL:  cfg.OCUA.BaseURL,
+			Username: cfg.OCUA.Username,
+			Password: cfg.OCUA.Password,
+			Store:    store,
+			Logger:   logger,
 
-	// setup logger
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{}))
-	slog.SetDefault(logger)
+			StartupTimeout: cfg.OCUA.StartupTimeoutDuration(),
+			OnHealth:       alerts.OnHealth,
+		}
+
+		err := httpClient.RunBackground(ctx)
+		if err != nil {
+			return err
+		}
+		client = httpClient
+	} else {
+		playwrightClient, closePlaywright, err := launchPlaywrightClient(ctx, cfg.OCUA, store, alerts.OnHealth, logger)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := closePlaywright()
+			if err != nil {
+				logger.Error("failed to stop playwright", "error", err)
+			}
+		}()
+		client = playwrightClient
+	}
+
+	// reuse recent pages so commands don't each load them from OCUA
+	ttl, maxStale := cfg.Cache.Durations()
+	cached := &ocua.CachedClient{
+		API:      client,
+		TTL:      ttl,
+		TeamTTL:  cfg.TeamTTLs(),
+		MaxStale: maxStale,
+		Logger:   logger,
+	}
+	defer cached.Close()
+
+	// setup the discord bot
+	b := &bot.Bot{
+		Client:        cached,
+		ApplicationID: cfg.Discord.ApplicationID,
+		GuildID:       cfg.Discord.GuildID,
+		Alerts:        alerts,
+	}
+
+	if cfg.History.Path != "" {
+		store, err := history.Open(cfg.History.Path)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		b.History = store
+	}
+
+	links, err := bot.OpenLinkStore(cfg.Links.Path)
+	if err != nil {
+		return err
+	}
+	b.Links = links
+
+	offsets := cfg.Reminders.Durations()
+	prefetch := cfg.Prefetch.Durations()
+
+	for _, teamConfig := range cfg.Teams {
+		team := &bot.Team{
+			ID:        teamConfig.ID,
+			ChannelID: teamConfig.ChannelID,
+			GuildID:   teamConfig.GuildID,
+			Players:   teamConfig.Players,
+		}
+		links.Apply(team)
+		b.Teams = append(b.Teams, team)
+
+		b.Prefetchers = append(b.Prefetchers, &bot.Prefetcher{
+			Bot:          b,
+			Team:         team,
+			Interval:     prefetch.Interval,
+			GameInterval: prefetch.GameInterval,
+			GameWindow:   prefetch.GameWindow,
+			MaxBackoff:   prefetch.MaxBackoff,
+		})
 
+		if teamConfig.NotifyChannelID != "" {
+			b.Watchers = append(b.Watchers, &bot.Watcher{
+				Bot:       b,
+				Team:      team,
+				ChannelID: teamConfig.NotifyChannelID,
+			})
+		}
+
+		thresholds := teamConfig.MinOpen > 0 || teamConfig.MinWoman > 0
+		if teamConfig.ReminderChannelID == "" && !thresholds {
+			continue
+		}
+
+		scheduler := &bot.Scheduler{
+			Bot:       b,
+			Team:      team,
+			ChannelID: teamConfig.ReminderChannelID,
+			StatePath: filepath.Join(cfg.Reminders.StateDir, fmt.Sprintf("reminders-%s.json", team.ID)),
+		}
+
+		// teams without a reminder channel only get alerts, which still look
+		// as far ahead as the first reminder
+		if teamConfig.ReminderChannelID != "" {
+			scheduler.Offsets = offsets
+		}
+		for _, offset := range offsets {
+			scheduler.AlertWindow = max(scheduler.AlertWindow, offset)
+		}
+
+		// before each team had its own file, the only team's reminders were
+		// saved to reminders.json
+		if len(cfg.Teams) == 1 {
+			scheduler.LegacyStatePath = filepath.Join(cfg.Reminders.StateDir, "reminders.json")
+		}
+
+		if thresholds {
+			scheduler.Threshold = &ocua.GenderThreshold{
+				Open:  teamConfig.MinOpen,
+				Woman: teamConfig.MinWoman,
+			}
+		}
+
+		b.Schedulers = append(b.Schedulers, scheduler)
+	}
+
+	// apply changes to the config file without restarting
+	watcher := &config.Watcher{
+		Path:     configPath,
+		Current:  cfg,
+		OnChange: reloadConfig(b),
+	}
+	go watcher.Run(ctx)
+
+	return b.Run(ctx, cfg.Discord.BotToken)
+}
+
+// launchPlaywrightClient starts a browser and logs in. the returned function
+// closes the browser contexts and stops playwright
+func launchPlaywrightClient(ctx context.Context, cfg config.OCUA, store *ocua.CookieStore, onHealth func(ocua.Health), logger *slog.Logger) (*ocua.Client, func() error, error) {
 	// setup playwright browser
 	startup := time.Now()
 	pw, err := playwright.Run()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{})
 	if err != nil {
-		return err
+		return nil, nil, errors.Join(err, pw.Stop())
+	}
+
+	stop := func() error {
+		// closing the browser closes its contexts, including the refresher's
+		return errors.Join(browser.Close(), pw.Stop())
 	}
 
 	dur := time.Since(startup)
 	logger.Info("launched playwright browser", "dur", dur.String())
 
-	// setup client browser context
+	// options for the browser contexts the refresher creates
 	contextOpts := playwright.BrowserNewContextOptions{
-		BaseURL: playwright.String(baseURL),
+		BaseURL: playwright.String(cfg.BaseURL),
 	}
 
-	context, err := browser.NewContext(contextOpts)
-	if err != nil {
-		return err
-	}
-	defer context.Close()
-
-	// setup client
-	client := &ocua.Client{
-		RWMutex:        sync.RWMutex{},
-		BrowserContext: context,
-	}
+	// the refresher logs in and swaps browser contexts into the client
+	client := &ocua.Client{}
 
 	refresher := &ocua.ClientSessionRefresher{
 		Browser:                  browser,
 		BrowserNewContextOptions: contextOpts,
 		Client:                   client,
-		Username:                 username,
-		Password:                 password,
+		Username:                 cfg.Username,
+		Password:                 cfg.Password,
+		Store:                    store,
+		StartupTimeout:           cfg.StartupTimeoutDuration(),
+		OnHealth:                 onHealth,
 		Logger:                   logger,
 	}
 
-	refresher.RunBackground()
-
-	// setup the discord bot
-	b := &bot.Bot{
-		TeamID:        teamID,
-		Client:        client,
-		ApplicationID: applicationID,
-		GuildID:       guildID,
-		Players:       players,
+	err = refresher.RunBackground(ctx)
+	if err != nil {
+		return nil, nil, errors.Join(err, stop())
 	}
 
-	b.Run(token)
-	return nil
+	return client, func() error {
+		return errors.Join(client.Close(), stop())
+	}, nil
 }
 
 func main() {
-	err := launch()
+	configPath := flag.String("config", "./data/config.yaml", "path to the config file")
+	flag.Parse()
+
+	// stop on ctrl-c or when the container is stopped
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := launch(ctx, *configPath)
 	if err != nil {
-		panic(err)
+		slog.Error("the bot stopped", "err", err)
+		os.Exit(1)
 	}
+
+	slog.Info("the bot stopped")
 }
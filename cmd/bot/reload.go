@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/bot"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/config"
+)
+
+// reloadConfig applies a changed config to the running bot. team channels,
+// guilds and players are swapped in for teams the bot is running, every other
+// change needs a restart. returns the config that was applied
+func reloadConfig(b *bot.Bot) func(prev, next *config.Config, changes []config.Change) *config.Config {
+	return func(prev, next *config.Config, changes []config.Change) *config.Config {
+		applied := *prev
+		applied.Teams = make([]config.Team, len(prev.Teams))
+		copy(applied.Teams, prev.Teams)
+
+		for _, team := range next.Teams {
+			// new teams aren't running yet
+			if !b.UpdateTeam(team.ID, team.ChannelID, team.GuildID, team.Players) {
+				continue
+			}
+
+			for i := range applied.Teams {
+				if applied.Teams[i].ID == team.ID {
+					applied.Teams[i].ChannelID = team.ChannelID
+					applied.Teams[i].GuildID = team.GuildID
+					applied.Teams[i].Players = team.Players
+				}
+			}
+		}
+
+		for _, change := range config.Diff(prev, &applied) {
+			slog.Info("config changed", "change", change.String())
+		}
+
+		for _, change := range config.Diff(&applied, next) {
+			slog.Warn("config changed, restart the bot to apply it", "change", change.String())
+		}
+
+		return &applied
+	}
+}
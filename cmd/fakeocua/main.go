@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua/ocuatest"
+)
+
+// runs the fake OCUA server with a sample team so the bot can be run locally
+// with ocua.base_url in the config pointed at it
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	username := flag.String("username", "captain@example.com", "username accepted by the login form")
+	password := flag.String("password", "password", "password accepted by the login form")
+	teamID := flag.String("team", "13313", "team id of the sample team")
+	ttl := flag.Duration("session-ttl", time.Hour*24*30, "how long sessions last")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		panic(err)
+	}
+
+	server := ocuatest.NewUnstartedServer(*username, *password)
+	server.Listener.Close()
+	server.Listener = listener
+	server.SessionTTL = *ttl
+	server.SetTeam(*teamID, ocuatest.SampleTeam(time.Now()))
+	server.Start()
+
+	fmt.Printf("fake OCUA server running at %s with team %s\n", server.URL, *teamID)
+	select {}
+}
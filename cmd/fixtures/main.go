@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/config"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+	"github.com/joho/godotenv"
+	"github.com/playwright-community/playwright-go"
+)
+
+// sanitizer replaces ids and names in captured pages with fake ones. ids are
+// replaced consistently so the team, attendance and schedule pages still line up
+type sanitizer struct {
+	ids   map[string]map[string]string // map of query param -> real id -> fake id
+	names map[string]string            // map of fake person id -> fake name
+	teams map[string]string            // map of fake team id -> fake name
+	text  map[string]string            // map of real name -> fake name, replaced in all text
+}
+
+// replaceText replaces every real name in the page's text. names are only
+// known once they've been seen in a link so pages are sanitized in order
+func (s *sanitizer) replaceText(doc *goquery.Document) {
+	names := []string{}
+	for name := range s.text {
+		if strings.TrimSpace(name) != "" {
+			names = append(names, name)
+		}
+	}
+
+	// replace longer names first so a name containing another is replaced whole
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, name, s.text[name])
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	doc.Find("*").Contents().Each(func(i int, node *goquery.Selection) {
+		if goquery.NodeName(node) == "#text" {
+			node.Nodes[0].Data = replacer.Replace(node.Nodes[0].Data)
+		}
+	})
+}
+
+// fake ids start at a different base for each kind of id
+var fakeIDBase = map[string]int{
+	"person": 1000,
+	"team":   2000,
+	"game":   3000,
+}
+
+func (s *sanitizer) fakeID(param, id string) string {
+	if s.ids[param] == nil {
+		s.ids[param] = map[string]string{}
+	}
+
+	fake, ok := s.ids[param][id]
+	if !ok {
+		fake = strconv.Itoa(fakeIDBase[param] + len(s.ids[param]) + 1)
+		s.ids[param][id] = fake
+	}
+	return fake
+}
+
+func (s *sanitizer) sanitize(page io.Reader) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return "", err
+	}
+
+	// remove anything that could contain session tokens or personal details
+	doc.Find("script, noscript, meta, input[type=hidden], #user-menu, .user-info").Remove()
+
+	doc.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		u, err := url.Parse(href)
+		if err != nil {
+			a.RemoveAttr("href")
+			return
+		}
+
+		query := u.Query()
+		for param := range fakeIDBase {
+			if id := query.Get(param); id != "" {
+				query.Set(param, s.fakeID(param, id))
+			}
+		}
+		u.RawQuery = query.Encode()
+		a.SetAttr("href", u.String())
+
+		// links to people use the person's name as their text
+		if person := query.Get("person"); person != "" && strings.HasSuffix(u.Path, "/people/view") {
+			name, ok := s.names[person]
+			if !ok {
+				name = fmt.Sprintf("Player %d", len(s.names)+1)
+				s.names[person] = name
+			}
+			s.text[strings.TrimSpace(a.Text())] = name
+			a.SetText(name)
+		}
+
+		// links to other teams on the schedule use the team's name as their text
+		if team := query.Get("team"); team != "" && strings.HasSuffix(u.Path, "/teams/view") {
+			name, ok := s.teams[team]
+			if !ok {
+				name = fmt.Sprintf("Team %d", len(s.teams)+1)
+				s.teams[team] = name
+			}
+			s.text[strings.TrimSpace(a.Text())] = name
+			a.SetText(name)
+		}
+	})
+
+	// headings and captions keep their structure, only the names in them change
+	s.replaceText(doc)
+
+	return goquery.OuterHtml(doc.Selection)
+}
+
+// capture logs in with the config's OCUA account and saves sanitized team, attendance and schedule pages as
+// parser test fixtures. run "go test ./internal/ocua -update" afterwards to
+// create the golden files
+func capture(configPath, teamID, name, dir, teamName string) error {
+	godotenv.Load()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	team, err := cfg.SelectTeam(teamID)
+	if err != nil {
+		return err
+	}
+
+	// setup browser
+	pw, err := playwright.Run()
+	if err != nil {
+		return err
+	}
+	defer pw.Stop()
+
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{})
+	if err != nil {
+		return err
+	}
+
+	browserContext, err := browser.NewContext(playwright.BrowserNewContextOptions{
+		BaseURL: playwright.String(cfg.OCUA.BaseURL),
+	})
+	if err != nil {
+		return err
+	}
+	defer browserContext.Close()
+
+	ctx := context.Background()
+
+	err = ocua.Login(ctx, cfg.OCUA.Username, cfg.OCUA.Password, browserContext)
+	if err != nil {
+		return err
+	}
+
+	s := &sanitizer{
+		ids:   map[string]map[string]string{},
+		names: map[string]string{},
+		teams: map[string]string{},
+		text:  map[string]string{},
+	}
+
+	// the team's own name isn't linked from its pages
+	if teamName != "" {
+		s.text[teamName] = "Sanitized Team"
+	}
+
+	pages := []struct {
+		prefix string
+		get    func(context.Context, string, playwright.BrowserContext) (*bytes.Buffer, error)
+	}{
+		{"team", ocua.GetTeamPage},
+		{"attendance", ocua.GetAttendancePage},
+		{"schedule", ocua.GetSchedulePage},
+	}
+
+	for _, page := range pages {
+		buf, err := page.get(ctx, team.ID, browserContext)
+		if err != nil {
+			return err
+		}
+
+		html, err := s.sanitize(buf)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%s_%s.html", page.prefix, name))
+		err = os.WriteFile(path, []byte(html), 0o644)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("saved", path)
+	}
+
+	return nil
+}
+
+func main() {
+	configPath := flag.String("config", "./data/config.yaml", "path to the config file")
+	teamID := flag.String("team", "", "id of the team to capture, defaults to the only team in the config")
+	name := flag.String("name", "", "fixture name, pages are saved as team_<name>.html, attendance_<name>.html and schedule_<name>.html")
+	dir := flag.String("dir", "./internal/ocua/testdata", "directory to save fixtures to")
+	teamName := flag.String("team-name", "", "the team's name on OCUA, replaced with \"Sanitized Team\"")
+	flag.Parse()
+
+	if *name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := capture(*configPath, *teamID, *name, *dir, *teamName)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -1,22 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
 
+	"github.com/danielholmes839/ocua-attendance-bot/internal/config"
 	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
 	"github.com/joho/godotenv"
 	"github.com/playwright-community/playwright-go"
 )
 
-func setup() error {
+// setup logs in with the config's OCUA account and prints the team's players
+// block for the config file
+func setup(configPath, teamID string) error {
 	godotenv.Load()
 
-	// ocua environment variables
-	username := os.Getenv("ocua_username")
-	password := os.Getenv("ocua_password")
-	teamID := os.Getenv("ocua_team_id")
-	baseURL := os.Getenv("ocua_base_url")
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	team, err := cfg.SelectTeam(teamID)
+	if err != nil {
+		return err
+	}
 
 	// setup browser
 	pw, err := playwright.Run()
@@ -30,21 +39,23 @@ func setup() error {
 
 	// setup client browser context
 	contextOpts := playwright.BrowserNewContextOptions{
-		BaseURL: playwright.String(baseURL),
+		BaseURL: playwright.String(cfg.OCUA.BaseURL),
 	}
 
-	context, err := browser.NewContext(contextOpts)
+	browserContext, err := browser.NewContext(contextOpts)
 	if err != nil {
 		return err
 	}
-	defer context.Close()
+	defer browserContext.Close()
+
+	ctx := context.Background()
 
-	err = ocua.Login(username, password, context)
+	err = ocua.Login(ctx, cfg.OCUA.Username, cfg.OCUA.Password, browserContext)
 	if err != nil {
 		return err
 	}
 
-	buf, err := ocua.GetTeamPage(teamID, context)
+	buf, err := ocua.GetTeamPage(ctx, team.ID, browserContext)
 	if err != nil {
 		return err
 	}
@@ -54,14 +65,24 @@ func setup() error {
 		return err
 	}
 
+	// players block for the team in the config file
+	fmt.Println("    players:")
 	for _, player := range players {
-		fmt.Printf("# %s\n", player.Name)
-		fmt.Printf("%q: %q\n\n", player.ID, "")
+		fmt.Printf("      # %s\n", player.Name)
+		fmt.Printf("      %q: %q\n", player.ID, "")
 	}
 
 	return nil
 }
 
 func main() {
-	setup()
+	configPath := flag.String("config", "./data/config.yaml", "path to the config file")
+	teamID := flag.String("team", "", "id of the team to list, defaults to the only team in the config")
+	flag.Parse()
+
+	err := setup(*configPath, *teamID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -3,21 +3,24 @@ module github.com/danielholmes839/ocua-attendance-bot
 go 1.22.0
 
 require (
-	github.com/PuerkitoBio/goquery v1.9.2 // indirect
+	github.com/PuerkitoBio/goquery v1.9.2
+	github.com/bwmarrin/discordgo v0.28.1
+	github.com/joho/godotenv v1.5.1
+	github.com/playwright-community/playwright-go v0.4401.1
+	go.etcd.io/bbolt v1.3.11
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
 	github.com/andybalholm/cascadia v1.3.2 // indirect
-	github.com/bwmarrin/discordgo v0.28.1 // indirect
 	github.com/deckarep/golang-set/v2 v2.6.0 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
 	github.com/gorilla/websocket v1.5.1 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/playwright-community/playwright-go v0.4401.1 // indirect
-	github.com/spf13/afero v1.11.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/crypto v0.22.0 // indirect
 	golang.org/x/exp v0.0.0-20240613232115-7f521ea00fb8 // indirect
 	golang.org/x/net v0.24.0 // indirect
 	golang.org/x/sys v0.19.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// AdminAlerts DMs an admin when logging in to OCUA keeps failing, then again
+// once it recovers. health reported before there's a discord session is held
+// and checked once it's set
+type AdminAlerts struct {
+	AdminID string // discord user id
+	After   int    // consecutive failures before alerting, defaults to 3
+
+	mu      sync.Mutex
+	session Session
+	health  *ocua.Health // latest health reported without a session
+	alerted bool         // an alert was sent and the session hasn't recovered since
+}
+
+func (alerts *AdminAlerts) setSession(s Session) {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+	alerts.session = s
+
+	if alerts.health != nil {
+		alerts.check(*alerts.health)
+		alerts.health = nil
+	}
+}
+
+// Connect lets the alerts DM the admin before the bot connects to discord.
+// DMs only use discord's REST API, so an alert can be sent while the bot is
+// still waiting for its first login to OCUA
+func (alerts *AdminAlerts) Connect(token string) error {
+	dg, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return err
+	}
+	alerts.setSession(dg)
+	return nil
+}
+
+func formatLoginAlert(health ocua.Health) string {
+	msg := fmt.Sprintf("Logging in to OCUA has failed %d times in a row, the bot can't read or update attendance until it works again.\n\nLast error: %s", health.ConsecutiveFailures, health.LastError)
+
+	switch {
+	case errors.Is(health.LastError, ocua.ErrBadCredentials):
+		msg += "\n\nOCUA rejected the username or password, check that the password in the config is up to date."
+	case errors.Is(health.LastError, ocua.ErrRateLimited):
+		msg += "\n\nOCUA is blocking logins, the bot will keep retrying less often."
+	}
+
+	return msg
+}
+
+func (alerts *AdminAlerts) send(content string) error {
+	channel, err := alerts.session.UserChannelCreate(alerts.AdminID)
+	if err != nil {
+		return err
+	}
+
+	_, err = alerts.session.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content: content,
+	})
+	return err
+}
+
+// OnHealth is called with the OCUA session health after every background login
+func (alerts *AdminAlerts) OnHealth(health ocua.Health) {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+
+	if alerts.session == nil {
+		alerts.health = &health
+		return
+	}
+	alerts.check(health)
+}
+
+// check sends an alert if the health needs one. the caller must hold mu and
+// have set the session
+func (alerts *AdminAlerts) check(health ocua.Health) {
+	after := alerts.After
+	if after == 0 {
+		after = 3
+	}
+
+	if alerts.AdminID == "" {
+		return
+	}
+
+	switch {
+	case health.ConsecutiveFailures >= after && !alerts.alerted:
+		err := alerts.send(formatLoginAlert(health))
+		if err != nil {
+			slog.Error("failed to alert admin", "err", err, "admin", alerts.AdminID)
+			return
+		}
+		alerts.alerted = true
+
+	case health.ConsecutiveFailures == 0 && alerts.alerted:
+		err := alerts.send("Logging in to OCUA is working again.")
+		if err != nil {
+			slog.Error("failed to alert admin", "err", err, "admin", alerts.AdminID)
+			return
+		}
+		alerts.alerted = false
+	}
+}
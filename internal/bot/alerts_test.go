@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/bot/bottest"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+func TestAdminAlerts(t *testing.T) {
+	recorder := &bottest.Recorder{}
+	alerts := &AdminAlerts{AdminID: "admin", After: 2}
+
+	failed := func(failures int) ocua.Health {
+		return ocua.Health{ConsecutiveFailures: failures, LastError: fmt.Errorf("%w: wrong password", ocua.ErrBadCredentials)}
+	}
+
+	// nothing is sent before connecting to discord
+	alerts.OnHealth(failed(2))
+	if len(recorder.Messages()) != 0 {
+		t.Fatalf("got %d messages before connecting, want 0", len(recorder.Messages()))
+	}
+
+	// the failures reported before connecting are alerted once connected
+	alerts.setSession(recorder)
+	if len(recorder.Messages()) != 1 {
+		t.Fatalf("got %d messages after connecting, want 1", len(recorder.Messages()))
+	}
+
+	alerts.OnHealth(failed(3))
+	alerts.OnHealth(failed(4))
+
+	messages := recorder.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	if messages[0].ChannelID != bottest.DMChannelID("admin") || !strings.Contains(messages[0].Content, "password") {
+		t.Errorf("unexpected alert in %s:\n%s", messages[0].ChannelID, messages[0].Content)
+	}
+
+	// recovering sends one more message
+	alerts.OnHealth(ocua.Health{})
+	alerts.OnHealth(ocua.Health{})
+
+	if len(recorder.Messages()) != 2 {
+		t.Errorf("got %d messages after recovering, want 2", len(recorder.Messages()))
+	}
+}
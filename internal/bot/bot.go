@@ -1,14 +1,17 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/history"
 	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
 )
 
@@ -33,10 +36,28 @@ func formatPlayers(players []ocua.Player, discordIds map[string]string) string {
 	return strings.Join(names, ", ")
 }
 
-func formatAttendanceReport(report ocua.AttendanceReport, gametime time.Time, players map[string]string) string {
+// formatGame describes the week's game, ex: "Mon Jun 3 6:45PM vs. Huckin' Eh at
+// Brewer Park 2". only the date is used if the game isn't on the schedule
+func formatGame(week ocua.Attendance) string {
+	game := week.Game
+	if game == nil {
+		return week.Gametime.Format("Monday Jan 2")
+	}
+
+	s := game.Start.Format("Mon Jan 2 3:04PM")
+	if game.OpponentName != "" {
+		s += " vs. " + game.OpponentName
+	}
+	if game.FieldName != "" {
+		s += " at " + game.FieldName
+	}
+	return s
+}
+
+func formatAttendanceReport(report ocua.AttendanceReport, week ocua.Attendance, teamID string, players map[string]string) string {
 	var sb strings.Builder
 
-	sb.WriteString(fmt.Sprintf("Current attendance for %s: %dO, %dW\n\n", gametime.Format("Monday Jan 2"), len(report.Open), len(report.Woman)))
+	sb.WriteString(fmt.Sprintf("Current attendance for %s: %dO, %dW\n\n", formatGame(week), len(report.Open), len(report.Woman)))
 
 	if len(report.Unknown) > 0 {
 		sb.WriteString(fmt.Sprintf("Reminder to please update your attendance: %s\n\n", formatPlayers(report.Unknown, players)))
@@ -46,7 +67,7 @@ func formatAttendanceReport(report ocua.AttendanceReport, gametime time.Time, pl
 		sb.WriteString(fmt.Sprintf("The following subs have been invited: %s\n\n", formatPlayers(report.Invited, players)))
 	}
 
-	sb.WriteString("[Click here to view game attendance on OCUA](https://www.ocua.ca/zuluru/teams/attendance?team=13313)")
+	sb.WriteString(fmt.Sprintf("[Click here to view game attendance on OCUA](https://www.ocua.ca/zuluru/teams/attendance?team=%s)", teamID))
 
 	return sb.String()
 }
@@ -72,35 +93,160 @@ func generateAutocomplete(attendance []ocua.Attendance, t time.Time) []*discordg
 }
 
 type Client interface {
-	GetTeam(teamID string) (map[string]ocua.Player, error)
-	GetAttendance(teamID string) ([]ocua.Attendance, error)
+	GetTeam(ctx context.Context, teamID string) (map[string]ocua.Player, error)
+	GetAttendance(ctx context.Context, teamID string) ([]ocua.Attendance, error)
+	GetSchedule(ctx context.Context, teamID string) ([]ocua.Game, error)
+	SetAttendance(ctx context.Context, teamID, playerID, date string, status ocua.AttendanceStatus) error
+}
+
+const (
+	// interactionTimeout is how long a handler waits on OCUA. discord only
+	// accepts edits to an interaction response for 15 minutes so this leaves
+	// time to tell the user it failed
+	interactionTimeout = 14 * time.Minute
+	// pollTimeout is how long a background poll waits on OCUA
+	pollTimeout = 2 * time.Minute
+	// shutdownTimeout is how long Run waits for in-flight interactions to
+	// finish before cancelling them
+	shutdownTimeout = 30 * time.Second
+)
+
+// sleepContext sleeps for d, returns false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// waitTimeout waits for wg, returns false if it takes longer than d
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
 }
 
 type Bot struct {
-	TeamID        string
+	Teams         []*Team
 	Client        Client
 	ApplicationID string
 	GuildID       string
-	Players       map[string]string // map of ocua id -> discord id
+	Schedulers    []*Scheduler   // optional attendance reminders
+	Watchers      []*Watcher     // optional attendance change notifications
+	Prefetchers   []*Prefetcher  // optional, keeps snapshots fresh for /attendance
+	History       *history.Store // optional attendance history
+	Links         *LinkStore     // optional, saves /link changes across restarts
+	Alerts        *AdminAlerts   // optional, DMs an admin when logging in to OCUA fails
 
 	sync.RWMutex
-	cachedAttendance []ocua.Attendance
+	cachedAttendance map[string][]ocua.Attendance // map of team id -> attendance
+	cachedPlayers    map[string]map[string]ocua.Player
+	snapshots        map[string]snapshot // map of team id -> data from the last live fetch
+
+	interactions sync.WaitGroup  // in-flight interactions
+	stopping     bool            // set once Run starts shutting down
+	handlerCtx   context.Context // cancelled when Run stops waiting for interactions
+}
+
+// interactionContext returns the context for handling an interaction. it's
+// cancelled when the interaction times out or Run stops waiting for it
+func (b *Bot) interactionContext() (context.Context, context.CancelFunc) {
+	b.RLock()
+	ctx := b.handlerCtx
+	b.RUnlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithTimeout(ctx, interactionTimeout)
+}
+
+// trackInteraction counts an in-flight interaction so Run can wait for it.
+// returns false once the bot is shutting down
+func (b *Bot) trackInteraction() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.stopping {
+		return false
+	}
+	b.interactions.Add(1)
+	return true
 }
 
-func (b *Bot) getCachedAttendance() []ocua.Attendance {
+func (b *Bot) getCachedAttendance(teamID string) []ocua.Attendance {
 	b.RLock()
 	defer b.RUnlock()
-	return b.cachedAttendance
+	return b.cachedAttendance[teamID]
+
+}
+
+func (b *Bot) setCachedAttendance(teamID string, attendance []ocua.Attendance) {
+	b.Lock()
+	defer b.Unlock()
+	if b.cachedAttendance == nil {
+		b.cachedAttendance = map[string][]ocua.Attendance{}
+	}
+	b.cachedAttendance[teamID] = attendance
+}
 
+func (b *Bot) getCachedPlayers(teamID string) map[string]ocua.Player {
+	b.RLock()
+	defer b.RUnlock()
+	return b.cachedPlayers[teamID]
 }
 
-func (b *Bot) setCachedAttendance(attendance []ocua.Attendance) {
+func (b *Bot) setCachedPlayers(teamID string, players map[string]ocua.Player) {
 	b.Lock()
 	defer b.Unlock()
-	b.cachedAttendance = attendance
+	if b.cachedPlayers == nil {
+		b.cachedPlayers = map[string]map[string]ocua.Player{}
+	}
+	b.cachedPlayers[teamID] = players
 }
 
-func (b *Bot) HandleAttendanceCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (b *Bot) HandleAttendanceCommand(s Responder, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		respondNoTeam(s, i)
+		return
+	}
+
+	options := getCommandOptions(i)
+	date := options["week"] // week in "YYYY-mm-dd"
+
+	// answer right away from the snapshot unless the user asked for live data
+	if snap, ok := b.getSnapshot(team.ID); ok && options["refresh"] != "true" {
+		content, err := formatReport(team, date, snap.players, snap.attendance)
+		if err == nil {
+			age := time.Since(snap.fetched)
+			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: fmt.Sprintf("%s\n\n_as of %s_", content, formatAge(age)),
+					Flags:   4,
+				},
+			})
+
+			slog.Info("successfully handled attendance command", "team", team.ID, "age", age.String())
+			return
+		}
+	}
+
 	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
@@ -109,24 +255,57 @@ func (b *Bot) HandleAttendanceCommand(s *discordgo.Session, i *discordgo.Interac
 		},
 	})
 
+	ctx, cancel := b.interactionContext()
+	defer cancel()
+
+	content := "failed to get team data"
+	snap, err := b.refreshSnapshot(ctx, team.ID)
+	if err == nil {
+		content, err = formatReport(team, date, snap.players, snap.attendance)
+	}
+	if err != nil {
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+		slog.Error(content, "err", err, "team", team.ID, "date", date)
+		return
+	}
+
+	// respond with report info
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+
+	slog.Info("successfully handled attendance command", "team", team.ID)
+}
+
+// fetchTeamAttendance gets the latest team and attendance data in parallel
+func (b *Bot) fetchTeamAttendance(ctx context.Context, teamID string) (map[string]ocua.Player, []ocua.Attendance, error) {
 	wg := sync.WaitGroup{}
-	wg.Add(2)
+	wg.Add(3)
 
 	var (
 		team          map[string]ocua.Player
 		teamErr       error
 		attendance    []ocua.Attendance
 		attendanceErr error
+		schedule      []ocua.Game
+		scheduleErr   error
 	)
 
-	// get team, attendance in parallel
+	// get team, attendance and schedule in parallel
+	go func() {
+		team, teamErr = b.Client.GetTeam(ctx, teamID)
+		wg.Done()
+	}()
+
 	go func() {
-		team, teamErr = b.Client.GetTeam(b.TeamID)
+		attendance, attendanceErr = b.Client.GetAttendance(ctx, teamID)
 		wg.Done()
 	}()
 
 	go func() {
-		attendance, attendanceErr = b.Client.GetAttendance(b.TeamID)
+		schedule, scheduleErr = b.Client.GetSchedule(ctx, teamID)
 		wg.Done()
 	}()
 
@@ -134,64 +313,148 @@ func (b *Bot) HandleAttendanceCommand(s *discordgo.Session, i *discordgo.Interac
 
 	// handle errors getting attendance data
 	if attendanceErr != nil {
-		msg := "failed to get team data"
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &msg,
-		})
+		return nil, nil, attendanceErr
+	}
 
-		slog.Error(msg, "err", attendanceErr)
-		return
+	b.recordHistory(teamID, attendance)
+
+	// the schedule only adds detail to reports, they still work without it
+	if scheduleErr != nil {
+		slog.Warn("failed to get schedule", "team", teamID, "err", scheduleErr)
+	} else {
+		attendance = ocua.JoinSchedule(attendance, schedule)
 	}
 
-	b.setCachedAttendance(attendance)
+	b.setCachedAttendance(teamID, attendance)
 
 	// handle errors getting team data
 	if teamErr != nil {
-		msg := "failed to get team data"
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &msg,
-		})
-		slog.Error(msg, "err", teamErr)
+		return nil, nil, teamErr
+	}
+
+	b.setCachedPlayers(teamID, team)
+
+	return team, attendance, nil
+}
+
+// recordHistory saves the attendance to the history store and logs any changes
+func (b *Bot) recordHistory(teamID string, attendance []ocua.Attendance) {
+	if b.History == nil {
 		return
 	}
 
+	transitions, err := b.History.Record(teamID, attendance, time.Now())
+	if err != nil {
+		slog.Error("failed to record attendance history", "team", teamID, "err", err)
+		return
+	}
+
+	for _, transition := range transitions {
+		slog.Info("attendance changed", "team", teamID, "player", transition.PlayerID, "gametime", transition.Gametime, "from", transition.From, "to", transition.To)
+	}
+}
+
+// generateReport fetches the latest team and attendance data and formats the
+// report for the week. on error the returned string is a message for the user
+func (b *Bot) generateReport(ctx context.Context, team *Team, date string) (string, error) {
+	players, attendance, err := b.fetchTeamAttendance(ctx, team.ID)
+	if err != nil {
+		return "failed to get team data", err
+	}
+
+	return formatReport(team, date, players, attendance)
+}
+
+// formatReport formats the report for the week. on error the returned string
+// is a message for the user
+func formatReport(team *Team, date string, players map[string]ocua.Player, attendance []ocua.Attendance) (string, error) {
 	// find attendance for the requested date
-	cmd := i.ApplicationCommandData()
-	date := cmd.Options[0].StringValue() // week in "YYYY-mm-dd"
-	index := -1
-	for i, week := range attendance {
-		if week.Gametime.Format("2006-01-02") == date {
-			index = i
-			break
-		}
+	week, ok := ocua.FindWeek(attendance, date)
+	if !ok {
+		return "failed to find matching week", fmt.Errorf("no week matching %q", date)
+	}
+
+	// get report info
+	report := ocua.GetAttendanceReport(week, players)
+	return formatAttendanceReport(report, week, team.ID, team.players()), nil
+}
+
+func getInteractionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
 	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+func (b *Bot) HandleRSVPCommand(s Responder, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		respondNoTeam(s, i)
+		return
+	}
+
+	playerID, ok := team.getPlayerID(getInteractionUserID(i))
+	if !ok {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "your discord account isn't linked to an OCUA player",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "updating attendance...",
+			Flags:   4,
+		},
+	})
+
+	options := getCommandOptions(i)
+	date := options["week"] // week in "YYYY-mm-dd"
+	status := ocua.AttendanceStatus(strings.ToUpper(options["status"]))
 
-	// no matching week
-	if index == -1 {
-		msg := "failed to find matching week"
+	ctx, cancel := b.interactionContext()
+	defer cancel()
+
+	err := b.setAttendance(ctx, team.ID, playerID, date, status)
+	if err != nil {
+		msg := "failed to update attendance"
 		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 			Content: &msg,
 		})
-		slog.Error(msg, "date", date)
+		slog.Error(msg, "err", err, "player", playerID, "date", date)
 		return
 	}
 
-	// get report info
-	report := ocua.GetAttendanceReport(attendance[index], team)
-	gametime := attendance[index].Gametime
-
-	content := formatAttendanceReport(report, gametime, b.Players)
+	// confirm with the updated report
+	content, err := b.generateReport(ctx, team, date)
+	if err != nil {
+		content = fmt.Sprintf("updated attendance but %s", content)
+		slog.Error(content, "err", err, "date", date)
+	}
 
-	// respond with report info
 	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 		Content: &content,
 	})
 
-	slog.Info("successfully handled attendance command")
+	slog.Info("successfully handled rsvp command", "team", team.ID, "player", playerID, "date", date, "status", status)
 }
 
-func (b *Bot) HandleAttendanceAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	attendance := b.getCachedAttendance()
+func (b *Bot) HandleAttendanceAutocomplete(s Responder, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		slog.Error("no team for autocomplete", "channel", i.ChannelID, "guild", i.GuildID)
+		return
+	}
+
+	attendance := b.getCachedAttendance(team.ID)
 	choices := generateAutocomplete(attendance, time.Now().Local())
 
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -209,16 +472,155 @@ func (b *Bot) HandleAttendanceAutocomplete(s *discordgo.Session, i *discordgo.In
 	slog.Info("successfully handled autocomplete")
 }
 
+func flattenOptions(options []*discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandInteractionDataOption {
+	flat := []*discordgo.ApplicationCommandInteractionDataOption{}
+	for _, option := range options {
+		if option.Type == discordgo.ApplicationCommandOptionSubCommand || option.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			flat = append(flat, flattenOptions(option.Options)...)
+			continue
+		}
+		flat = append(flat, option)
+	}
+	return flat
+}
+
+// getCommandOptions returns the string options of a command including the
+// options of its subcommand
+func getCommandOptions(i *discordgo.InteractionCreate) map[string]string {
+	options := map[string]string{}
+	for _, option := range flattenOptions(i.ApplicationCommandData().Options) {
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionString:
+			options[option.Name] = option.StringValue()
+		case discordgo.ApplicationCommandOptionBoolean:
+			options[option.Name] = strconv.FormatBool(option.BoolValue())
+		}
+	}
+	return options
+}
+
+// getFocusedOption returns the option being autocompleted
+func getFocusedOption(i *discordgo.InteractionCreate) (string, string) {
+	for _, option := range flattenOptions(i.ApplicationCommandData().Options) {
+		if option.Focused && option.Type == discordgo.ApplicationCommandOptionString {
+			return option.Name, option.StringValue()
+		}
+	}
+	return "", ""
+}
+
+func generatePlayerAutocomplete(players map[string]ocua.Player, query string, include func(ocua.Player) bool) []*discordgo.ApplicationCommandOptionChoice {
+	sorted := []ocua.Player{}
+	for _, player := range players {
+		if include(player) && strings.Contains(strings.ToLower(player.Name), strings.ToLower(query)) {
+			sorted = append(sorted, player)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, player := range sorted {
+		// discord allows at most 25 choices
+		if len(choices) == 25 {
+			break
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  player.Name,
+			Value: player.ID,
+		})
+	}
+
+	return choices
+}
+
+func (b *Bot) HandlePlayerAutocomplete(s Responder, i *discordgo.InteractionCreate, include func(ocua.Player) bool) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		slog.Error("no team for autocomplete", "channel", i.ChannelID, "guild", i.GuildID)
+		return
+	}
+
+	_, query := getFocusedOption(i)
+	choices := generatePlayerAutocomplete(b.getCachedPlayers(team.ID), query, include)
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+
+	if err != nil {
+		slog.Error("failed to send autocomplete data", "err", err)
+		return
+	}
+
+	slog.Info("successfully handled player autocomplete")
+}
+
+// HandleInteractionCreate is the discordgo event handler for interactions
 func (b *Bot) HandleInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !b.trackInteraction() {
+		slog.Warn("ignoring interaction, the bot is shutting down", "id", i.ID)
+		return
+	}
+	defer b.interactions.Done()
+
+	b.HandleInteraction(s, i)
+}
+
+// HandleInteraction routes an interaction to its handler
+func (b *Bot) HandleInteraction(s Session, i *discordgo.InteractionCreate) {
 	if i.Type == discordgo.InteractionApplicationCommand {
 		command := i.ApplicationCommandData()
-		if command.Name == "attendance" {
+		switch command.Name {
+		case "attendance":
 			b.HandleAttendanceCommand(s, i)
+		case "rsvp":
+			b.HandleRSVPCommand(s, i)
+		case "stats":
+			b.HandleStatsCommand(s, i)
+		case "sub":
+			b.HandleSubInviteCommand(s, i)
+		case "link":
+			b.HandleLinkCommand(s, i)
+		case "unlink":
+			b.HandleUnlinkCommand(s, i)
+		case "links":
+			b.HandleLinksCommand(s, i)
 		}
 	}
 
 	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
-		b.HandleAttendanceAutocomplete(s, i)
+		command := i.ApplicationCommandData()
+		focused, _ := getFocusedOption(i)
+
+		switch {
+		case focused == "player" && command.Name == "sub":
+			b.HandlePlayerAutocomplete(s, i, isSubstitute)
+		case focused == "player" && command.Name == "link":
+			b.HandleLinkAutocomplete(s, i, false)
+		case focused == "player" && command.Name == "unlink":
+			b.HandleLinkAutocomplete(s, i, true)
+		case focused == "player":
+			b.HandlePlayerAutocomplete(s, i, func(player ocua.Player) bool { return true })
+		default:
+			b.HandleAttendanceAutocomplete(s, i)
+		}
+	}
+
+	if i.Type == discordgo.InteractionMessageComponent {
+		customID := i.MessageComponentData().CustomID
+		switch {
+		case strings.HasPrefix(customID, "sub:"):
+			b.HandleSubResponse(s, i)
+		case strings.HasPrefix(customID, "link:"):
+			b.HandleLinkResponse(s, i)
+		}
 	}
 }
 
@@ -235,25 +637,76 @@ func (b *Bot) RegisterAttendanceCommand(dg *discordgo.Session) error {
 				Required:     true,
 				Autocomplete: true,
 			},
+			{
+				Name:        "refresh",
+				Description: "Get the latest attendance from OCUA instead of the last snapshot",
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+			},
+		},
+	})
+	return err
+}
+
+func (b *Bot) RegisterRSVPCommand(dg *discordgo.Session) error {
+	_, err := dg.ApplicationCommandCreate(b.ApplicationID, "", &discordgo.ApplicationCommand{
+		Name:        "rsvp",
+		Description: "Update your attendance on OCUA",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:         "week",
+				Description:  "The week to update attendance for",
+				Type:         discordgo.ApplicationCommandOptionString,
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Name:        "status",
+				Description: "Your attendance",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "attending", Value: "attending"},
+					{Name: "absent", Value: "absent"},
+					{Name: "available", Value: "available"},
+				},
+			},
 		},
 	})
 	return err
 }
 
-func (b *Bot) Run(token string) error {
+// Run starts the bot and blocks until ctx is cancelled. it then waits for
+// in-flight interactions and background jobs to finish and closes the session
+func (b *Bot) Run(ctx context.Context, token string) error {
 	dg, err := discordgo.New("Bot " + token)
 	if err != nil {
 		return err
 	}
 
-	b.RegisterAttendanceCommand(dg)
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
 
-	attendance, err := b.Client.GetAttendance(b.TeamID)
-	if err != nil {
-		return err
-	}
+	b.Lock()
+	b.handlerCtx = handlerCtx
+	b.Unlock()
 
-	b.setCachedAttendance(attendance)
+	b.RegisterAttendanceCommand(dg)
+	b.RegisterRSVPCommand(dg)
+	b.RegisterStatsCommand(dg)
+	b.RegisterSubCommand(dg)
+	b.RegisterLinkCommand(dg)
+	b.RegisterUnlinkCommand(dg)
+	b.RegisterLinksCommand(dg)
+
+	for _, team := range b.Teams {
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		_, err := b.refreshSnapshot(pollCtx, team.ID)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
 
 	dg.AddHandler(b.HandleInteractionCreate)
 
@@ -262,6 +715,54 @@ func (b *Bot) Run(token string) error {
 		return err
 	}
 
+	if b.Alerts != nil {
+		b.Alerts.setSession(dg)
+	}
+
+	background := sync.WaitGroup{}
+
+	for _, scheduler := range b.Schedulers {
+		scheduler.Session = dg
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			scheduler.Run(ctx)
+		}()
+	}
+
+	for _, watcher := range b.Watchers {
+		watcher.Session = dg
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			watcher.Run(ctx)
+		}()
+	}
+
+	for _, prefetcher := range b.Prefetchers {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			prefetcher.Run(ctx)
+		}()
+	}
+
 	slog.Info("the bot is running!")
-	select {}
+	<-ctx.Done()
+	slog.Info("shutting down")
+
+	b.Lock()
+	b.stopping = true
+	b.Unlock()
+
+	// give in-flight interactions a chance to respond before cancelling them
+	if !waitTimeout(&b.interactions, shutdownTimeout) {
+		slog.Warn("cancelling in-flight interactions", "timeout", shutdownTimeout)
+		cancelHandlers()
+		b.interactions.Wait()
+	}
+
+	background.Wait()
+
+	return dg.Close()
 }
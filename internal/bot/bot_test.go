@@ -0,0 +1,349 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/bot/bottest"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+type setAttendanceCall struct {
+	TeamID   string
+	PlayerID string
+	Date     string
+	Status   ocua.AttendanceStatus
+}
+
+// fakeClient is an in memory OCUA client
+type fakeClient struct {
+	sync.Mutex
+	team        map[string]ocua.Player
+	attendance  []ocua.Attendance
+	schedule    []ocua.Game
+	calls       []setAttendanceCall
+	fetches     int   // calls to GetAttendance
+	err         error // returned by GetAttendance when set
+	scheduleErr error // returned by GetSchedule when set
+}
+
+func (client *fakeClient) GetTeam(ctx context.Context, teamID string) (map[string]ocua.Player, error) {
+	client.Lock()
+	defer client.Unlock()
+	return client.team, nil
+}
+
+func (client *fakeClient) GetAttendance(ctx context.Context, teamID string) ([]ocua.Attendance, error) {
+	client.Lock()
+	defer client.Unlock()
+	client.fetches++
+	if client.err != nil {
+		return nil, client.err
+	}
+	return client.attendance, nil
+}
+
+func (client *fakeClient) GetSchedule(ctx context.Context, teamID string) ([]ocua.Game, error) {
+	client.Lock()
+	defer client.Unlock()
+	if client.scheduleErr != nil {
+		return nil, client.scheduleErr
+	}
+	return client.schedule, nil
+}
+
+func (client *fakeClient) SetAttendance(ctx context.Context, teamID, playerID, date string, status ocua.AttendanceStatus) error {
+	client.Lock()
+	defer client.Unlock()
+
+	client.calls = append(client.calls, setAttendanceCall{teamID, playerID, date, status})
+
+	week, ok := ocua.FindWeek(client.attendance, date)
+	if ok {
+		week.Players[playerID] = status
+	}
+	return nil
+}
+
+func newTestBot() (*Bot, *fakeClient, time.Time) {
+	gametime := time.Now().Add(time.Hour * 48).Truncate(time.Minute)
+
+	client := &fakeClient{
+		team: map[string]ocua.Player{
+			"1": {ID: "1", Name: "Alex", Role: "Captain", Gender: "O"},
+			"2": {ID: "2", Name: "Blair", Role: "Regular player", Gender: "W"},
+			"3": {ID: "3", Name: "Casey", Role: "Regular player", Gender: "O"},
+			"4": {ID: "4", Name: "Emery", Role: "Substitute player", Gender: "W"},
+		},
+		attendance: []ocua.Attendance{
+			{
+				Gametime: gametime.Add(-time.Hour * 24 * 7),
+				Players:  map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.ATTENDING, "3": ocua.ABSENT, "4": ocua.UNKNOWN},
+			},
+			{
+				Gametime: gametime,
+				Players:  map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.UNKNOWN, "3": ocua.UNKNOWN, "4": ocua.UNKNOWN},
+			},
+		},
+		schedule: []ocua.Game{
+			{
+				ID:           "3001",
+				Start:        gametime,
+				End:          gametime.Add(time.Minute * 90),
+				OpponentID:   "2002",
+				OpponentName: "Huckin' Eh",
+				FieldName:    "Brewer Park 2",
+				FieldCode:    "BRE 2",
+			},
+		},
+	}
+
+	b := &Bot{
+		Client: client,
+		Teams: []*Team{
+			{
+				ID:        "13313",
+				ChannelID: "team-channel",
+				Players:   map[string]string{"1": "d1", "2": "d2", "4": "d4"},
+			},
+		},
+	}
+
+	return b, client, gametime
+}
+
+func TestAttendanceCommand(t *testing.T) {
+	b, _, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "attendance", bottest.Option("week", gametime.Format("2006-01-02"))))
+
+	if len(recorder.Responses()) != 1 {
+		t.Fatalf("got %d responses, want 1", len(recorder.Responses()))
+	}
+
+	content := recorder.LastContent()
+	for _, want := range []string{
+		"1O, 0W",
+		"<@d2>", // linked player that hasn't entered attendance
+		"Casey", // unlinked player that hasn't entered attendance
+		"team=13313",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("report doesn't contain %q:\n%s", want, content)
+		}
+	}
+
+	if strings.Contains(content, "Emery") {
+		t.Errorf("report shouldn't remind substitutes:\n%s", content)
+	}
+}
+
+func TestAttendanceCommandShowsGame(t *testing.T) {
+	b, _, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "attendance", bottest.Option("week", gametime.Format("2006-01-02"))))
+
+	want := fmt.Sprintf("Current attendance for %s vs. Huckin' Eh at Brewer Park 2:", gametime.Format("Mon Jan 2 3:04PM"))
+	if content := recorder.LastContent(); !strings.Contains(content, want) {
+		t.Errorf("report doesn't contain %q:\n%s", want, content)
+	}
+}
+
+func TestAttendanceCommandWithoutSchedule(t *testing.T) {
+	b, client, gametime := newTestBot()
+	client.scheduleErr = errors.New("schedule unavailable")
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "attendance", bottest.Option("week", gametime.Format("2006-01-02"))))
+
+	want := fmt.Sprintf("Current attendance for %s:", gametime.Format("Monday Jan 2"))
+	if content := recorder.LastContent(); !strings.Contains(content, want) {
+		t.Errorf("report doesn't contain %q:\n%s", want, content)
+	}
+}
+
+func TestAttendanceCommandUnknownWeek(t *testing.T) {
+	b, _, _ := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "attendance", bottest.Option("week", "1999-01-01")))
+
+	if content := recorder.LastContent(); content != "failed to find matching week" {
+		t.Errorf("content = %q, want %q", content, "failed to find matching week")
+	}
+}
+
+func TestStatsCommand(t *testing.T) {
+	b, _, _ := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "stats"))
+
+	content := recorder.LastContent()
+
+	for _, want := range []string{
+		fmt.Sprintf("%-20s %4d %4d %4d %6s\n", "Alex", 1, 0, 0, "-"),
+		fmt.Sprintf("%-20s %4d %4d %4d %6s\n", "Casey", 0, 1, 0, "-"),
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content = %q, want it to contain %q", content, want)
+		}
+	}
+
+	// emery is a sub who wasn't invited last week
+	if strings.Contains(content, "Emery") {
+		t.Errorf("content = %q, want no row for emery", content)
+	}
+}
+
+func TestCommandInUnlinkedChannel(t *testing.T) {
+	b, _, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "other-channel", "d1", "attendance", bottest.Option("week", gametime.Format("2006-01-02"))))
+
+	responses := recorder.Responses()
+	if len(responses) != 1 {
+		t.Fatalf("got %d responses, want 1", len(responses))
+	}
+
+	if responses[0].Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Errorf("expected an ephemeral response, got flags %d", responses[0].Data.Flags)
+	}
+
+	if len(recorder.Edits()) != 0 {
+		t.Errorf("expected no report to be generated")
+	}
+}
+
+func TestRSVPCommand(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+	date := gametime.Format("2006-01-02")
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d2", "rsvp", bottest.Option("week", date), bottest.Option("status", "attending")))
+
+	want := setAttendanceCall{"13313", "2", date, ocua.ATTENDING}
+	if len(client.calls) != 1 || client.calls[0] != want {
+		t.Fatalf("calls = %+v, want [%+v]", client.calls, want)
+	}
+
+	if content := recorder.LastContent(); !strings.Contains(content, "1O, 1W") {
+		t.Errorf("expected the updated report, got:\n%s", content)
+	}
+}
+
+func TestRSVPCommandUnlinkedUser(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "stranger", "rsvp", bottest.Option("week", gametime.Format("2006-01-02")), bottest.Option("status", "attending")))
+
+	if len(client.calls) != 0 {
+		t.Errorf("expected attendance not to change, got %+v", client.calls)
+	}
+
+	if content := recorder.LastContent(); !strings.Contains(content, "isn't linked") {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestAttendanceAutocomplete(t *testing.T) {
+	b, client, gametime := newTestBot()
+	b.setCachedAttendance("13313", client.attendance)
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Autocomplete("guild", "team-channel", "d1", "attendance", bottest.Focused("week", "")))
+
+	responses := recorder.Responses()
+	if len(responses) != 1 {
+		t.Fatalf("got %d responses, want 1", len(responses))
+	}
+
+	choices := responses[0].Data.Choices
+	if len(choices) != 1 || choices[0].Value != gametime.Format("2006-01-02") {
+		t.Errorf("expected only the upcoming week as a choice, got %+v", choices)
+	}
+}
+
+func TestSubInvite(t *testing.T) {
+	b, client, gametime := newTestBot()
+	b.setCachedPlayers("13313", client.team)
+	recorder := &bottest.Recorder{}
+	date := gametime.Format("2006-01-02")
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "sub", bottest.Subcommand("invite", bottest.Option("week", date), bottest.Option("player", "4"))))
+
+	want := setAttendanceCall{"13313", "4", date, ocua.INVITED}
+	if len(client.calls) != 1 || client.calls[0] != want {
+		t.Fatalf("calls = %+v, want [%+v]", client.calls, want)
+	}
+
+	messages := recorder.Messages()
+	if len(messages) != 1 || messages[0].ChannelID != bottest.DMChannelID("d4") {
+		t.Fatalf("expected a DM to the sub, got %+v", messages)
+	}
+
+	// the sub accepts from the DM
+	recorder = &bottest.Recorder{}
+	b.HandleInteraction(recorder, bottest.Button("d4", subResponseID("accept", "13313", "4", date)))
+
+	want = setAttendanceCall{"13313", "4", date, ocua.ATTENDING}
+	if len(client.calls) != 2 || client.calls[1] != want {
+		t.Fatalf("calls = %+v, want second call %+v", client.calls, want)
+	}
+
+	responses := recorder.Responses()
+	if len(responses) != 1 || responses[0].Type != discordgo.InteractionResponseDeferredMessageUpdate {
+		t.Fatalf("expected the click to be acknowledged before updating OCUA, got %+v", responses)
+	}
+
+	edits := recorder.Edits()
+	if len(edits) != 1 || edits[0].Components == nil || len(*edits[0].Components) != 0 {
+		t.Fatalf("expected the invite to be edited without buttons, got %+v", edits)
+	}
+
+	if content := recorder.LastContent(); !strings.Contains(content, "You're attending") {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestSubInviteFromNonCaptain(t *testing.T) {
+	b, client, gametime := newTestBot()
+	b.setCachedPlayers("13313", client.team)
+	recorder := &bottest.Recorder{}
+
+	// d2 is linked to a regular player
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d2", "sub", bottest.Subcommand("invite", bottest.Option("week", gametime.Format("2006-01-02")), bottest.Option("player", "4"))))
+
+	if len(client.calls) != 0 {
+		t.Errorf("expected attendance not to change, got %+v", client.calls)
+	}
+
+	if len(recorder.Messages()) != 0 {
+		t.Errorf("expected no DM to the sub, got %+v", recorder.Messages())
+	}
+
+	if content := recorder.LastContent(); content != "only captains can invite substitutes" {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestSubResponseFromWrongUser(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Button("d1", subResponseID("accept", "13313", "4", gametime.Format("2006-01-02"))))
+
+	if len(client.calls) != 0 {
+		t.Errorf("expected attendance not to change, got %+v", client.calls)
+	}
+}
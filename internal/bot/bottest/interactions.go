@@ -0,0 +1,97 @@
+package bottest
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// Option is a string option of a synthetic command
+func Option(name, value string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  name,
+		Type:  discordgo.ApplicationCommandOptionString,
+		Value: value,
+	}
+}
+
+// BoolOption is a boolean option of a synthetic command
+func BoolOption(name string, value bool) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  name,
+		Type:  discordgo.ApplicationCommandOptionBoolean,
+		Value: value,
+	}
+}
+
+// Focused is the string option being autocompleted
+func Focused(name, value string) *discordgo.ApplicationCommandInteractionDataOption {
+	option := Option(name, value)
+	option.Focused = true
+	return option
+}
+
+// Subcommand wraps options in a subcommand
+func Subcommand(name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionSubCommand,
+		Options: options,
+	}
+}
+
+func interaction(t discordgo.InteractionType, guildID, channelID, userID string, data discordgo.InteractionData) *discordgo.InteractionCreate {
+	i := &discordgo.Interaction{
+		ID:        "interaction",
+		Type:      t,
+		GuildID:   guildID,
+		ChannelID: channelID,
+		Data:      data,
+	}
+
+	// interactions in guilds come from members, DMs come from users
+	user := &discordgo.User{ID: userID}
+	if guildID != "" {
+		i.Member = &discordgo.Member{User: user}
+	} else {
+		i.User = user
+	}
+
+	return &discordgo.InteractionCreate{Interaction: i}
+}
+
+// Command is a synthetic slash command
+func Command(guildID, channelID, userID, name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionApplicationCommand, guildID, channelID, userID, discordgo.ApplicationCommandInteractionData{
+		Name:    name,
+		Options: options,
+	})
+}
+
+// Autocomplete is a synthetic autocomplete request, one of the options should be Focused
+func Autocomplete(guildID, channelID, userID, name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionApplicationCommandAutocomplete, guildID, channelID, userID, discordgo.ApplicationCommandInteractionData{
+		Name:    name,
+		Options: options,
+	})
+}
+
+// Button is a synthetic button press in a DM
+func Button(userID, customID string) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionMessageComponent, "", DMChannelID(userID), userID, discordgo.MessageComponentInteractionData{
+		CustomID:      customID,
+		ComponentType: discordgo.ButtonComponent,
+	})
+}
+
+// ChannelButton is a synthetic button press on a message in a guild channel
+func ChannelButton(guildID, channelID, userID, customID string) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionMessageComponent, guildID, channelID, userID, discordgo.MessageComponentInteractionData{
+		CustomID:      customID,
+		ComponentType: discordgo.ButtonComponent,
+	})
+}
+
+// Admin gives the member who created a guild interaction the manage server permission
+func Admin(i *discordgo.InteractionCreate) *discordgo.InteractionCreate {
+	i.Member.Permissions = discordgo.PermissionManageServer
+	return i
+}
@@ -0,0 +1,106 @@
+// Package bottest provides a fake discord session and synthetic interactions
+// for testing the bot's handlers
+package bottest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Message is a message posted to a channel
+type Message struct {
+	ChannelID string
+	*discordgo.MessageSend
+}
+
+// Recorder is a fake discord session that records everything the bot sends
+type Recorder struct {
+	mu        sync.Mutex
+	responses []*discordgo.InteractionResponse
+	edits     []*discordgo.WebhookEdit
+	messages  []Message
+
+	// Err is returned from every call when set
+	Err error
+}
+
+func (recorder *Recorder) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.responses = append(recorder.responses, resp)
+	return recorder.Err
+}
+
+func (recorder *Recorder) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.edits = append(recorder.edits, newresp)
+	return &discordgo.Message{}, recorder.Err
+}
+
+func (recorder *Recorder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.messages = append(recorder.messages, Message{ChannelID: channelID, MessageSend: data})
+	return &discordgo.Message{ChannelID: channelID, Content: data.Content}, recorder.Err
+}
+
+// UserChannelCreate returns a DM channel with the id "dm:<user id>"
+func (recorder *Recorder) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: DMChannelID(recipientID), Type: discordgo.ChannelTypeDM}, recorder.Err
+}
+
+// DMChannelID is the id of the DM channel the recorder creates for a user
+func DMChannelID(userID string) string {
+	return fmt.Sprintf("dm:%s", userID)
+}
+
+// Responses returns the interaction responses in the order they were sent
+func (recorder *Recorder) Responses() []*discordgo.InteractionResponse {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return append([]*discordgo.InteractionResponse{}, recorder.responses...)
+}
+
+// Edits returns the interaction response edits in the order they were sent
+func (recorder *Recorder) Edits() []*discordgo.WebhookEdit {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return append([]*discordgo.WebhookEdit{}, recorder.edits...)
+}
+
+// Messages returns the channel messages in the order they were sent
+func (recorder *Recorder) Messages() []Message {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return append([]Message{}, recorder.messages...)
+}
+
+// LastContent returns the content of the latest edit, or the latest response
+// when nothing has been edited
+func (recorder *Recorder) LastContent() string {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if len(recorder.edits) > 0 {
+		edit := recorder.edits[len(recorder.edits)-1]
+		if edit.Content != nil {
+			return *edit.Content
+		}
+		return ""
+	}
+
+	if len(recorder.responses) > 0 {
+		response := recorder.responses[len(recorder.responses)-1]
+		if response.Data != nil {
+			return response.Data.Content
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,443 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/fileutil"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// LinkStore persists the discord accounts linked with /link. links are saved
+// to Path as json and take precedence over the player mappings in the config
+type LinkStore struct {
+	Path string
+
+	mu    sync.Mutex
+	links map[string]map[string]string // map of team id -> ocua id -> discord id, "" when unlinked
+}
+
+func OpenLinkStore(path string) (*LinkStore, error) {
+	store := &LinkStore{
+		Path:  path,
+		links: map[string]map[string]string{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &store.links)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return store, nil
+}
+
+// Apply updates the team's players with the saved links
+func (store *LinkStore) Apply(team *Team) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for playerID, discordID := range store.links[team.ID] {
+		team.setDiscordID(playerID, discordID)
+	}
+}
+
+// overlay updates a map of ocua id -> discord id with the saved links
+func (store *LinkStore) overlay(teamID string, players map[string]string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for playerID, discordID := range store.links[teamID] {
+		if discordID == "" {
+			delete(players, playerID)
+		} else {
+			players[playerID] = discordID
+		}
+	}
+}
+
+// Set saves a link, an empty discord id saves the player as unlinked. the
+// links are only updated once they're saved
+func (store *LinkStore) Set(teamID, playerID, discordID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// copy the team's links so a failed save leaves them unchanged
+	team := map[string]string{}
+	for id, linked := range store.links[teamID] {
+		team[id] = linked
+	}
+	team[playerID] = discordID
+
+	links := map[string]map[string]string{}
+	for id, players := range store.links {
+		links[id] = players
+	}
+	links[teamID] = team
+
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = fileutil.WriteFileAtomic(store.Path, data, 0o644)
+	if err != nil {
+		return err
+	}
+
+	store.links = links
+	return nil
+}
+
+// setLink links a player to a discord user, an empty discord id unlinks them.
+// the link is saved before the team is updated so a failed save changes nothing
+func (b *Bot) setLink(team *Team, playerID, discordID string) error {
+	if b.Links != nil {
+		err := b.Links.Set(team.ID, playerID, discordID)
+		if err != nil {
+			return err
+		}
+	}
+
+	team.setDiscordID(playerID, discordID)
+	return nil
+}
+
+// isAdmin returns true if the user can manage the discord server
+func isAdmin(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+	return i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0
+}
+
+// canApprove returns true if the user is a server admin or linked to a captain of the team
+func (b *Bot) canApprove(team *Team, i *discordgo.InteractionCreate) bool {
+	if isAdmin(i) {
+		return true
+	}
+
+	playerID, ok := team.getPlayerID(getInteractionUserID(i))
+	if !ok {
+		return false
+	}
+
+	player, ok := b.getCachedPlayers(team.ID)[playerID]
+	return ok && strings.Contains(strings.ToLower(player.Role), "captain")
+}
+
+// link request buttons have custom ids in the format "link:<approve|deny>:<team id>:<player id>:<discord id>"
+func linkResponseID(response, teamID, playerID, discordID string) string {
+	return strings.Join([]string{"link", response, teamID, playerID, discordID}, ":")
+}
+
+func parseLinkResponseID(customID string) (response, teamID, playerID, discordID string, err error) {
+	parts := strings.Split(customID, ":")
+	if len(parts) != 5 || parts[0] != "link" {
+		return "", "", "", "", fmt.Errorf("invalid link response id: %q", customID)
+	}
+	return parts[1], parts[2], parts[3], parts[4], nil
+}
+
+func formatLinkRequest(player ocua.Player, teamID, discordID string) *discordgo.InteractionResponseData {
+	return &discordgo.InteractionResponseData{
+		Content: fmt.Sprintf("<@%s> wants to link their discord account to %s, a captain needs to approve", discordID, player.Name),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{},
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Approve",
+						Style:    discordgo.SuccessButton,
+						CustomID: linkResponseID("approve", teamID, player.ID, discordID),
+					},
+					discordgo.Button{
+						Label:    "Deny",
+						Style:    discordgo.DangerButton,
+						CustomID: linkResponseID("deny", teamID, player.ID, discordID),
+					},
+				},
+			},
+		},
+	}
+}
+
+func formatLinks(players map[string]ocua.Player, links map[string]string) string {
+	sorted := []ocua.Player{}
+	for _, player := range players {
+		sorted = append(sorted, player)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	linked := []string{}
+	unlinked := []string{}
+	for _, player := range sorted {
+		discordID, ok := links[player.ID]
+		if ok && discordID != "" {
+			linked = append(linked, fmt.Sprintf("- %s: <@%s>", player.Name, discordID))
+		} else {
+			unlinked = append(unlinked, fmt.Sprintf("- %s", player.Name))
+		}
+	}
+
+	msg := fmt.Sprintf("Linked (%d):\n%s", len(linked), strings.Join(linked, "\n"))
+	if len(unlinked) > 0 {
+		msg += fmt.Sprintf("\n\nNot linked (%d):\n%s", len(unlinked), strings.Join(unlinked, "\n"))
+	}
+	return msg
+}
+
+func respondEphemeral(s Responder, i *discordgo.InteractionCreate, content string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Users: []string{},
+			},
+		},
+	})
+}
+
+// HandleLinkCommand links the user to the player they picked. captains and
+// admins are linked immediately, anyone else posts a request for a captain to approve
+func (b *Bot) HandleLinkCommand(s Responder, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		respondNoTeam(s, i)
+		return
+	}
+
+	discordID := getInteractionUserID(i)
+	playerID := getCommandOptions(i)["player"]
+
+	player, ok := b.getCachedPlayers(team.ID)[playerID]
+	if !ok {
+		respondEphemeral(s, i, "failed to find player")
+		return
+	}
+
+	if current, ok := team.getPlayerID(discordID); ok {
+		respondEphemeral(s, i, fmt.Sprintf("your discord account is already linked to %s, use /unlink first", b.getCachedPlayers(team.ID)[current].Name))
+		return
+	}
+
+	if _, ok := team.getDiscordID(playerID); ok {
+		respondEphemeral(s, i, fmt.Sprintf("%s is already linked to another discord account", player.Name))
+		return
+	}
+
+	if !b.canApprove(team, i) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: formatLinkRequest(player, team.ID, discordID),
+		})
+		slog.Info("requested link", "team", team.ID, "player", playerID, "discord", discordID)
+		return
+	}
+
+	err := b.setLink(team, playerID, discordID)
+	if err != nil {
+		respondEphemeral(s, i, "failed to save link")
+		slog.Error("failed to save link", "err", err, "team", team.ID, "player", playerID)
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("linked your discord account to %s", player.Name))
+	slog.Info("successfully handled link command", "team", team.ID, "player", playerID, "discord", discordID)
+}
+
+// HandleLinkResponse handles a captain pressing approve or deny on a link request
+func (b *Bot) HandleLinkResponse(s Responder, i *discordgo.InteractionCreate) {
+	response, teamID, playerID, discordID, err := parseLinkResponseID(i.MessageComponentData().CustomID)
+	if err != nil {
+		slog.Error("failed to parse link response", "err", err)
+		return
+	}
+
+	team, ok := findTeamByID(b.Teams, teamID)
+	if !ok || !b.canApprove(team, i) {
+		respondEphemeral(s, i, "only captains can approve links")
+		return
+	}
+
+	respond := func(content string) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    content,
+				Components: []discordgo.MessageComponent{},
+				AllowedMentions: &discordgo.MessageAllowedMentions{
+					Users: []string{},
+				},
+			},
+		})
+	}
+
+	name := playerID
+	if player, ok := b.getCachedPlayers(team.ID)[playerID]; ok {
+		name = player.Name
+	}
+	approverID := getInteractionUserID(i)
+
+	if response != "approve" {
+		respond(fmt.Sprintf("<@%s>'s request to link to %s was denied by <@%s>", discordID, name, approverID))
+		return
+	}
+
+	// the player or user may have been linked since the request was posted
+	if current, ok := team.getDiscordID(playerID); ok && current != discordID {
+		respond(fmt.Sprintf("%s is already linked to another discord account", name))
+		return
+	}
+	if current, ok := team.getPlayerID(discordID); ok && current != playerID {
+		respond(fmt.Sprintf("<@%s> is already linked to another player", discordID))
+		return
+	}
+
+	err = b.setLink(team, playerID, discordID)
+	if err != nil {
+		respondEphemeral(s, i, "failed to save link, please try again")
+		slog.Error("failed to save link", "err", err, "team", team.ID, "player", playerID)
+		return
+	}
+
+	respond(fmt.Sprintf("<@%s> is now linked to %s, approved by <@%s>", discordID, name, approverID))
+	slog.Info("successfully handled link response", "team", team.ID, "player", playerID, "discord", discordID)
+}
+
+// HandleUnlinkCommand unlinks the user, or the player option which only captains can use
+func (b *Bot) HandleUnlinkCommand(s Responder, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		respondNoTeam(s, i)
+		return
+	}
+
+	playerID, ok := getCommandOptions(i)["player"]
+	if ok {
+		if !b.canApprove(team, i) {
+			respondEphemeral(s, i, "only captains can unlink other players")
+			return
+		}
+	} else {
+		playerID, ok = team.getPlayerID(getInteractionUserID(i))
+		if !ok {
+			respondEphemeral(s, i, "your discord account isn't linked to an OCUA player")
+			return
+		}
+	}
+
+	err := b.setLink(team, playerID, "")
+	if err != nil {
+		respondEphemeral(s, i, "failed to save link")
+		slog.Error("failed to remove link", "err", err, "team", team.ID, "player", playerID)
+		return
+	}
+
+	name := playerID
+	if player, ok := b.getCachedPlayers(team.ID)[playerID]; ok {
+		name = player.Name
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("unlinked %s", name))
+	slog.Info("successfully handled unlink command", "team", team.ID, "player", playerID)
+}
+
+// HandleLinksCommand lists which players are linked to discord accounts
+func (b *Bot) HandleLinksCommand(s Responder, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		respondNoTeam(s, i)
+		return
+	}
+
+	if !isAdmin(i) {
+		respondEphemeral(s, i, "only server admins can list links")
+		return
+	}
+
+	respondEphemeral(s, i, formatLinks(b.getCachedPlayers(team.ID), team.players()))
+	slog.Info("successfully handled links command", "team", team.ID)
+}
+
+// HandleLinkAutocomplete suggests players that are linked or not linked
+func (b *Bot) HandleLinkAutocomplete(s Responder, i *discordgo.InteractionCreate, linked bool) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		slog.Error("no team for autocomplete", "channel", i.ChannelID, "guild", i.GuildID)
+		return
+	}
+
+	b.HandlePlayerAutocomplete(s, i, func(player ocua.Player) bool {
+		_, ok := team.getDiscordID(player.ID)
+		return ok == linked
+	})
+}
+
+func (b *Bot) RegisterLinkCommand(dg *discordgo.Session) error {
+	_, err := dg.ApplicationCommandCreate(b.ApplicationID, "", &discordgo.ApplicationCommand{
+		Name:        "link",
+		Description: "Link your discord account to your OCUA player",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:         "player",
+				Description:  "Your name on OCUA",
+				Type:         discordgo.ApplicationCommandOptionString,
+				Required:     true,
+				Autocomplete: true,
+			},
+		},
+	})
+	return err
+}
+
+func (b *Bot) RegisterUnlinkCommand(dg *discordgo.Session) error {
+	_, err := dg.ApplicationCommandCreate(b.ApplicationID, "", &discordgo.ApplicationCommand{
+		Name:        "unlink",
+		Description: "Unlink your discord account from OCUA",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:         "player",
+				Description:  "The player to unlink, captains only",
+				Type:         discordgo.ApplicationCommandOptionString,
+				Autocomplete: true,
+			},
+		},
+	})
+	return err
+}
+
+func (b *Bot) RegisterLinksCommand(dg *discordgo.Session) error {
+	permissions := int64(discordgo.PermissionManageServer)
+
+	_, err := dg.ApplicationCommandCreate(b.ApplicationID, "", &discordgo.ApplicationCommand{
+		Name:                     "links",
+		Description:              "List which players are linked to discord accounts",
+		Type:                     discordgo.ChatApplicationCommand,
+		DefaultMemberPermissions: &permissions,
+	})
+	return err
+}
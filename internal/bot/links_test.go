@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/bot/bottest"
+)
+
+func TestLinkApprovedByCaptain(t *testing.T) {
+	b, client, _ := newTestBot()
+	b.setCachedPlayers("13313", client.team)
+
+	path := filepath.Join(t.TempDir(), "links.json")
+	links, err := OpenLinkStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Links = links
+
+	// Casey requests to be linked
+	recorder := &bottest.Recorder{}
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d3", "link", bottest.Option("player", "3")))
+
+	responses := recorder.Responses()
+	if len(responses) != 1 || len(responses[0].Data.Components) != 1 {
+		t.Fatalf("expected a link request with buttons, got %+v", responses)
+	}
+
+	if _, ok := b.Teams[0].getDiscordID("3"); ok {
+		t.Fatal("player shouldn't be linked before the request is approved")
+	}
+
+	// another player can't approve
+	recorder = &bottest.Recorder{}
+	b.HandleInteraction(recorder, bottest.ChannelButton("guild", "team-channel", "d2", linkResponseID("approve", "13313", "3", "d3")))
+
+	if _, ok := b.Teams[0].getDiscordID("3"); ok {
+		t.Fatal("only captains should be able to approve links")
+	}
+
+	// the captain approves
+	recorder = &bottest.Recorder{}
+	b.HandleInteraction(recorder, bottest.ChannelButton("guild", "team-channel", "d1", linkResponseID("approve", "13313", "3", "d3")))
+
+	if discordID, _ := b.Teams[0].getDiscordID("3"); discordID != "d3" {
+		t.Fatalf("discord id = %q, want d3", discordID)
+	}
+
+	if content := recorder.LastContent(); !strings.Contains(content, "now linked to Casey") {
+		t.Errorf("content = %q", content)
+	}
+
+	// the link is saved across restarts
+	links, err = OpenLinkStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	team := &Team{ID: "13313"}
+	links.Apply(team)
+	if discordID, _ := team.getDiscordID("3"); discordID != "d3" {
+		t.Errorf("saved discord id = %q, want d3", discordID)
+	}
+}
+
+func TestLinkByAdmin(t *testing.T) {
+	b, client, _ := newTestBot()
+	b.setCachedPlayers("13313", client.team)
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Admin(bottest.Command("guild", "team-channel", "d3", "link", bottest.Option("player", "3"))))
+
+	if discordID, _ := b.Teams[0].getDiscordID("3"); discordID != "d3" {
+		t.Fatalf("discord id = %q, want d3", discordID)
+	}
+}
+
+func TestLinkAlreadyLinkedPlayer(t *testing.T) {
+	b, client, _ := newTestBot()
+	b.setCachedPlayers("13313", client.team)
+	recorder := &bottest.Recorder{}
+
+	b.HandleInteraction(recorder, bottest.Admin(bottest.Command("guild", "team-channel", "stranger", "link", bottest.Option("player", "2"))))
+
+	if discordID, _ := b.Teams[0].getDiscordID("2"); discordID != "d2" {
+		t.Errorf("discord id = %q, want d2", discordID)
+	}
+
+	if content := recorder.LastContent(); !strings.Contains(content, "already linked") {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestUnlink(t *testing.T) {
+	b, client, _ := newTestBot()
+	b.setCachedPlayers("13313", client.team)
+
+	// players can't unlink someone else
+	recorder := &bottest.Recorder{}
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d2", "unlink", bottest.Option("player", "4")))
+
+	if _, ok := b.Teams[0].getDiscordID("4"); !ok {
+		t.Fatal("player shouldn't be able to unlink someone else")
+	}
+
+	// players can unlink themselves
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d2", "unlink"))
+
+	if _, ok := b.Teams[0].getDiscordID("2"); ok {
+		t.Error("expected the player to be unlinked")
+	}
+}
+
+func TestUpdateTeamKeepsLinks(t *testing.T) {
+	b, _, _ := newTestBot()
+
+	links, err := OpenLinkStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Links = links
+
+	err = b.setLink(b.Teams[0], "3", "d3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the reloaded config moves the team and doesn't know about the new link
+	ok := b.UpdateTeam("13313", "new-channel", "", map[string]string{"1": "d1", "2": "d2-new"})
+	if !ok {
+		t.Fatal("expected the team to be updated")
+	}
+
+	team, ok := findTeam(b.Teams, "new-channel", "guild")
+	if !ok || team.ID != "13313" {
+		t.Fatal("expected the team to be found in its new channel")
+	}
+
+	players := team.players()
+	if players["2"] != "d2-new" || players["3"] != "d3" {
+		t.Errorf("players = %v", players)
+	}
+
+	if _, ok := players["4"]; ok {
+		t.Errorf("expected players removed from the config to be unlinked, got %v", players)
+	}
+}
+
+func TestLinkStoreFailedSaveChangesNothing(t *testing.T) {
+	// the store's directory is a file so saving fails
+	blocker := filepath.Join(t.TempDir(), "data")
+	err := os.WriteFile(blocker, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenLinkStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Path = filepath.Join(blocker, "links.json")
+
+	err = store.Set("13313", "2", "d2")
+	if err == nil {
+		t.Fatal("expected saving to fail")
+	}
+
+	players := map[string]string{}
+	store.overlay("13313", players)
+	if len(players) != 0 {
+		t.Errorf("links = %v, want none after a failed save", players)
+	}
+}
+
+func TestLinkThenReloadConfig(t *testing.T) {
+	b, client, _ := newTestBot()
+	b.setCachedPlayers("13313", client.team)
+
+	links, err := OpenLinkStore(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Links = links
+
+	// the team's players come from the config, which is read on every reload
+	config := map[string]string{"1": "d1", "2": "d2", "4": "d4"}
+	b.Teams[0].Players = config
+
+	recorder := &bottest.Recorder{}
+	b.HandleInteraction(recorder, bottest.Admin(bottest.Command("guild", "team-channel", "d3", "link", bottest.Option("player", "3"))))
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d2", "unlink"))
+
+	if len(config) != 3 || config["2"] != "d2" {
+		t.Fatalf("links changed the config's players: %v", config)
+	}
+
+	// reloading the unchanged config keeps the links
+	b.UpdateTeam("13313", "team-channel", "", config)
+
+	players := b.Teams[0].players()
+	if players["3"] != "d3" {
+		t.Errorf("players = %v, want 3 linked to d3", players)
+	}
+	if _, ok := players["2"]; ok {
+		t.Errorf("players = %v, want 2 unlinked", players)
+	}
+}
@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// snapshot is a team's data from the last live fetch
+type snapshot struct {
+	players    map[string]ocua.Player
+	attendance []ocua.Attendance
+	fetched    time.Time
+}
+
+// refresher is implemented by clients that cache pages, like ocua.CachedClient
+type refresher interface {
+	Refresh(teamID string)
+}
+
+func (b *Bot) getSnapshot(teamID string) (snapshot, bool) {
+	b.RLock()
+	defer b.RUnlock()
+	snap, ok := b.snapshots[teamID]
+	return snap, ok
+}
+
+// dropSnapshot forgets the team's snapshot after a write so reports don't show
+// the old attendance
+func (b *Bot) dropSnapshot(teamID string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.snapshots, teamID)
+}
+
+// refreshSnapshot fetches the team's data from OCUA, skipping any cached pages,
+// and saves it as the team's snapshot. concurrent refreshes share the cache's
+// fetches
+func (b *Bot) refreshSnapshot(ctx context.Context, teamID string) (snapshot, error) {
+	if cache, ok := b.Client.(refresher); ok {
+		cache.Refresh(teamID)
+	}
+
+	fetched := time.Now()
+	players, attendance, err := b.fetchTeamAttendance(ctx, teamID)
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	snap := snapshot{players: players, attendance: attendance, fetched: fetched}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.snapshots == nil {
+		b.snapshots = map[string]snapshot{}
+	}
+	b.snapshots[teamID] = snap
+
+	return snap, nil
+}
+
+// setAttendance changes a player's attendance and drops the team's snapshot
+func (b *Bot) setAttendance(ctx context.Context, teamID, playerID, date string, status ocua.AttendanceStatus) error {
+	defer b.dropSnapshot(teamID)
+	return b.Client.SetAttendance(ctx, teamID, playerID, date, status)
+}
+
+// formatAge formats how long ago data was fetched, ex: "3 min ago"
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%d min ago", int(age.Minutes()))
+	case age < time.Hour*2:
+		return "1 hour ago"
+	}
+	return fmt.Sprintf("%d hours ago", int(age.Hours()))
+}
+
+// Prefetcher keeps a team's snapshot fresh so /attendance can answer without
+// waiting on OCUA. it refreshes more often when a game is coming up and backs
+// off while OCUA is failing
+type Prefetcher struct {
+	Bot  *Bot
+	Team *Team
+
+	Interval     time.Duration // defaults to 15 minutes
+	GameInterval time.Duration // used within GameWindow of a game, defaults to 2 minutes
+	GameWindow   time.Duration // defaults to 6 hours
+	MaxBackoff   time.Duration // defaults to 1 hour
+
+	Now func() time.Time // defaults to time.Now
+
+	failures int // consecutive failed refreshes
+}
+
+func (prefetcher *Prefetcher) now() time.Time {
+	if prefetcher.Now != nil {
+		return prefetcher.Now()
+	}
+	return time.Now()
+}
+
+// interval returns how long to wait between refreshes when OCUA is working
+func (prefetcher *Prefetcher) interval() time.Duration {
+	interval := prefetcher.Interval
+	if interval == 0 {
+		interval = time.Minute * 15
+	}
+
+	gameInterval := prefetcher.GameInterval
+	if gameInterval == 0 {
+		gameInterval = time.Minute * 2
+	}
+
+	window := prefetcher.GameWindow
+	if window == 0 {
+		window = time.Hour * 6
+	}
+
+	snap, ok := prefetcher.Bot.getSnapshot(prefetcher.Team.ID)
+	if !ok {
+		return interval
+	}
+
+	now := prefetcher.now()
+	for _, week := range snap.attendance {
+		if week.Gametime.After(now) && week.Gametime.Sub(now) <= window {
+			return min(gameInterval, interval)
+		}
+	}
+
+	return interval
+}
+
+// next returns how long to wait before the next refresh. failures double the
+// wait up to MaxBackoff
+func (prefetcher *Prefetcher) next(err error) time.Duration {
+	if err == nil {
+		prefetcher.failures = 0
+		return prefetcher.interval()
+	}
+
+	maxBackoff := prefetcher.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = time.Hour
+	}
+
+	prefetcher.failures++
+	backoff := prefetcher.interval()
+	for range prefetcher.failures {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
+
+// RunOnce refreshes the team's snapshot and returns how long to wait before
+// the next refresh
+func (prefetcher *Prefetcher) RunOnce(ctx context.Context) (time.Duration, error) {
+	_, err := prefetcher.Bot.refreshSnapshot(ctx, prefetcher.Team.ID)
+	return prefetcher.next(err), err
+}
+
+// Run refreshes the team's snapshot until ctx is cancelled. the first refresh
+// waits an interval since the bot fetches every team when it starts
+func (prefetcher *Prefetcher) Run(ctx context.Context) {
+	wait := prefetcher.interval()
+
+	for {
+		if !sleepContext(ctx, wait) {
+			return
+		}
+
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		var err error
+		wait, err = prefetcher.RunOnce(pollCtx)
+		cancel()
+
+		// errors from cancelling ctx aren't worth logging
+		if err != nil && ctx.Err() == nil {
+			slog.Error("failed to prefetch attendance", "team", prefetcher.Team.ID, "err", err, "failures", prefetcher.failures, "retry", wait.String())
+		}
+	}
+}
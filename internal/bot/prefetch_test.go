@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/bot/bottest"
+)
+
+func TestAttendanceCommandFromSnapshot(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	_, err := b.refreshSnapshot(context.Background(), "13313")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "attendance", bottest.Option("week", gametime.Format("2006-01-02"))))
+
+	if client.fetches != 1 {
+		t.Errorf("fetches = %d, want 1", client.fetches)
+	}
+
+	if len(recorder.Responses()) != 1 || len(recorder.Edits()) != 0 {
+		t.Fatalf("got %d responses and %d edits, want the report in the response", len(recorder.Responses()), len(recorder.Edits()))
+	}
+
+	content := recorder.LastContent()
+	if !strings.Contains(content, "1O, 0W") || !strings.Contains(content, "as of just now") {
+		t.Errorf("unexpected report:\n%s", content)
+	}
+
+	// refresh skips the snapshot
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d1", "attendance", bottest.Option("week", gametime.Format("2006-01-02")), bottest.BoolOption("refresh", true)))
+
+	if client.fetches != 2 {
+		t.Errorf("fetches = %d after refreshing, want 2", client.fetches)
+	}
+
+	if content := recorder.LastContent(); strings.Contains(content, "as of") {
+		t.Errorf("refreshed report shouldn't show its age:\n%s", content)
+	}
+}
+
+func TestRSVPDropsSnapshot(t *testing.T) {
+	b, _, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	_, err := b.refreshSnapshot(context.Background(), "13313")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.HandleInteraction(recorder, bottest.Command("guild", "team-channel", "d2", "rsvp", bottest.Option("week", gametime.Format("2006-01-02")), bottest.Option("status", "attending")))
+
+	if _, ok := b.getSnapshot("13313"); ok {
+		t.Error("expected the snapshot to be dropped after updating attendance")
+	}
+}
+
+func TestPrefetcherInterval(t *testing.T) {
+	b, client, gametime := newTestBot()
+	now := gametime.Add(-time.Hour * 24)
+
+	prefetcher := &Prefetcher{
+		Bot:          b,
+		Team:         b.Teams[0],
+		Interval:     time.Minute * 15,
+		GameInterval: time.Minute * 2,
+		GameWindow:   time.Hour * 6,
+		MaxBackoff:   time.Hour,
+		Now:          func() time.Time { return now },
+	}
+
+	wait, err := prefetcher.RunOnce(context.Background())
+	if err != nil || wait != time.Minute*15 {
+		t.Errorf("wait = %s, err = %v, want 15m", wait, err)
+	}
+
+	// refreshes faster close to the game
+	now = gametime.Add(-time.Hour)
+	wait, _ = prefetcher.RunOnce(context.Background())
+	if wait != time.Minute*2 {
+		t.Errorf("wait = %s before the game, want 2m", wait)
+	}
+
+	// backs off while OCUA is failing
+	client.err = errors.New("ocua is down")
+	for _, want := range []time.Duration{time.Minute * 4, time.Minute * 8, time.Minute * 16, time.Minute * 32, time.Hour, time.Hour} {
+		wait, err = prefetcher.RunOnce(context.Background())
+		if err == nil || wait != want {
+			t.Errorf("wait = %s, err = %v, want %s", wait, err, want)
+		}
+	}
+
+	client.err = nil
+	wait, _ = prefetcher.RunOnce(context.Background())
+	if wait != time.Minute*2 {
+		t.Errorf("wait = %s after recovering, want 2m", wait)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	for age, want := range map[time.Duration]string{
+		time.Second * 10: "just now",
+		time.Minute * 3:  "3 min ago",
+		time.Minute * 90: "1 hour ago",
+		time.Hour * 5:    "5 hours ago",
+	} {
+		if got := formatAge(age); got != want {
+			t.Errorf("formatAge(%s) = %q, want %q", age, got, want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/fileutil"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// Scheduler posts attendance reminders before each game to ChannelID and alerts
+// the team's channel when a game is short players. messages that have already
+// been posted are saved to StatePath so restarts don't post them twice
+type Scheduler struct {
+	Bot       *Bot
+	Team      *Team
+	Session   MessageSender
+	ChannelID string          // reminders, and alerts when the team doesn't have a channel
+	Offsets   []time.Duration // time before the game to post reminders, none if empty
+	StatePath string
+	// optional state file from before teams had their own, read when StatePath
+	// doesn't exist yet so upgrading doesn't post every reminder again
+	LegacyStatePath string
+	Interval        time.Duration    // time between checks
+	Now             func() time.Time // clock, defaults to time.Now
+
+	// optional alerts for upcoming games that are short players on a gender line
+	Threshold   *ocua.GenderThreshold
+	AlertWindow time.Duration // how far ahead to check, defaults to the largest offset
+
+	fired map[string]time.Time // map of reminder key -> gametime
+}
+
+func reminderKey(gametime time.Time, offset time.Duration) string {
+	return fmt.Sprintf("%s/%s", gametime.Format(time.RFC3339), offset)
+}
+
+func formatReminder(report ocua.AttendanceReport, week ocua.Attendance, teamID string, players map[string]string) *discordgo.MessageSend {
+	// only ping the players who haven't entered their attendance
+	mentions := []string{}
+	for _, player := range report.Unknown {
+		discordID, ok := players[player.ID]
+		if ok && discordID != "" {
+			mentions = append(mentions, discordID)
+		}
+	}
+
+	return &discordgo.MessageSend{
+		Content: formatAttendanceReport(report, week, teamID, players),
+		Flags:   discordgo.MessageFlagsSuppressEmbeds,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: mentions,
+		},
+	}
+}
+
+func alertKey(gametime time.Time, open, woman int) string {
+	return fmt.Sprintf("alert/%s/%dO/%dW", gametime.Format(time.RFC3339), open, woman)
+}
+
+func formatThresholdAlert(week ocua.Attendance, team map[string]ocua.Player, open, woman int, players map[string]string) *discordgo.MessageSend {
+	report := ocua.GetAttendanceReport(week, team)
+
+	short := []string{}
+	if open > 0 {
+		short = append(short, fmt.Sprintf("%d more O", open))
+	}
+	if woman > 0 {
+		short = append(short, fmt.Sprintf("%d more W", woman))
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Not enough players for %s: need %s (currently %dO, %dW)\n\n", formatGame(week), strings.Join(short, " and "), len(report.Open), len(report.Woman)))
+
+	for _, line := range []struct {
+		gender string
+		short  int
+	}{{"O", open}, {"W", woman}} {
+		if line.short == 0 {
+			continue
+		}
+
+		subs := ocua.GetAvailableSubs(week, team, line.gender)
+		if len(subs) == 0 {
+			sb.WriteString(fmt.Sprintf("No %s subs available to invite\n\n", line.gender))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s subs available to invite: %s\n\n", line.gender, formatPlayers(subs, players)))
+		}
+	}
+
+	return &discordgo.MessageSend{
+		Content: strings.TrimSpace(sb.String()),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{}, // don't ping subs
+		},
+	}
+}
+
+func (scheduler *Scheduler) alertWindow() time.Duration {
+	if scheduler.AlertWindow != 0 {
+		return scheduler.AlertWindow
+	}
+
+	window := time.Duration(0)
+	for _, offset := range scheduler.Offsets {
+		window = max(window, offset)
+	}
+	return window
+}
+
+// alertChannel returns the team's channel, or ChannelID for teams that are
+// only linked to a guild
+func (scheduler *Scheduler) alertChannel() string {
+	channelID, _ := scheduler.Team.location()
+	if channelID == "" {
+		return scheduler.ChannelID
+	}
+	return channelID
+}
+
+// alert posts an alert if the week is short players. the same shortfall is only
+// posted once, a new alert is posted if the shortfall changes
+func (scheduler *Scheduler) alert(week ocua.Attendance, team map[string]ocua.Player, now time.Time) error {
+	if scheduler.Threshold == nil || now.Before(week.Gametime.Add(-scheduler.alertWindow())) {
+		return nil
+	}
+
+	report := ocua.GetAttendanceReport(week, team)
+	open, woman := scheduler.Threshold.Shortfall(report)
+	if open == 0 && woman == 0 {
+		return nil
+	}
+
+	key := alertKey(week.Gametime, open, woman)
+	if _, ok := scheduler.fired[key]; ok {
+		return nil
+	}
+
+	msg := formatThresholdAlert(week, team, open, woman, scheduler.Team.players())
+
+	_, err := scheduler.Session.ChannelMessageSendComplex(scheduler.alertChannel(), msg)
+	if err != nil {
+		return err
+	}
+
+	scheduler.fired[key] = week.Gametime
+
+	slog.Info("posted attendance threshold alert", "team", scheduler.Team.ID, "gametime", week.Gametime, "open", open, "woman", woman)
+	return scheduler.save()
+}
+
+func (scheduler *Scheduler) now() time.Time {
+	if scheduler.Now != nil {
+		return scheduler.Now()
+	}
+	return time.Now()
+}
+
+func (scheduler *Scheduler) load() error {
+	scheduler.fired = map[string]time.Time{}
+
+	data, err := os.ReadFile(scheduler.StatePath)
+	if errors.Is(err, os.ErrNotExist) && scheduler.LegacyStatePath != "" {
+		data, err = os.ReadFile(scheduler.LegacyStatePath)
+		if err == nil {
+			slog.Info("migrating reminder state", "team", scheduler.Team.ID, "from", scheduler.LegacyStatePath, "to", scheduler.StatePath)
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &scheduler.fired)
+}
+
+func (scheduler *Scheduler) save() error {
+	data, err := json.Marshal(scheduler.fired)
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteFileAtomic(scheduler.StatePath, data, 0o644)
+}
+
+// due returns the offsets for the week that are due but haven't been posted yet
+func (scheduler *Scheduler) due(gametime, now time.Time) []time.Duration {
+	due := []time.Duration{}
+	for _, offset := range scheduler.Offsets {
+		if now.Before(gametime.Add(-offset)) {
+			continue
+		}
+		if _, ok := scheduler.fired[reminderKey(gametime, offset)]; ok {
+			continue
+		}
+		due = append(due, offset)
+	}
+	return due
+}
+
+// RunOnce posts any reminders that are due
+func (scheduler *Scheduler) RunOnce(ctx context.Context) error {
+	if scheduler.fired == nil {
+		err := scheduler.load()
+		if err != nil {
+			return err
+		}
+	}
+
+	now := scheduler.now()
+
+	// forget reminders for games that have already happened
+	for key, gametime := range scheduler.fired {
+		if now.After(gametime) {
+			delete(scheduler.fired, key)
+		}
+	}
+
+	team, attendance, err := scheduler.Bot.fetchTeamAttendance(ctx, scheduler.Team.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, week := range attendance {
+		if now.After(week.Gametime) {
+			continue
+		}
+
+		err := scheduler.alert(week, team, now)
+		if err != nil {
+			return err
+		}
+
+		// when several reminders are due at once (after downtime) only post one
+		due := scheduler.due(week.Gametime, now)
+		if len(due) == 0 {
+			continue
+		}
+
+		report := ocua.GetAttendanceReport(week, team)
+		msg := formatReminder(report, week, scheduler.Team.ID, scheduler.Team.players())
+
+		_, err = scheduler.Session.ChannelMessageSendComplex(scheduler.ChannelID, msg)
+		if err != nil {
+			return err
+		}
+
+		for _, offset := range due {
+			scheduler.fired[reminderKey(week.Gametime, offset)] = week.Gametime
+		}
+
+		err = scheduler.save()
+		if err != nil {
+			return err
+		}
+
+		slog.Info("posted attendance reminder", "team", scheduler.Team.ID, "gametime", week.Gametime)
+	}
+
+	return nil
+}
+
+// Run checks for due reminders every Interval until ctx is cancelled
+func (scheduler *Scheduler) Run(ctx context.Context) {
+	interval := scheduler.Interval
+	if interval == 0 {
+		interval = time.Minute * 5
+	}
+
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		err := scheduler.RunOnce(pollCtx)
+		cancel()
+
+		// errors from cancelling ctx aren't worth logging
+		if err != nil && ctx.Err() == nil {
+			slog.Error("failed to post attendance reminders", "team", scheduler.Team.ID, "err", err)
+		}
+
+		if !sleepContext(ctx, interval) {
+			return
+		}
+	}
+}
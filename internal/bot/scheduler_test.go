@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/bot/bottest"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+func TestSchedulerPostsOncePerOffset(t *testing.T) {
+	b, _, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+	statePath := filepath.Join(t.TempDir(), "reminders.json")
+
+	now := gametime.Add(-time.Hour * 30)
+	newScheduler := func() *Scheduler {
+		return &Scheduler{
+			Bot:       b,
+			Team:      b.Teams[0],
+			Session:   recorder,
+			ChannelID: "reminders",
+			Offsets:   []time.Duration{time.Hour * 72, time.Hour * 24, time.Hour * 4},
+			StatePath: statePath,
+			Now:       func() time.Time { return now },
+		}
+	}
+
+	scheduler := newScheduler()
+
+	// the 72h reminder is due
+	err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 1 {
+		t.Fatalf("got %d messages, want 1", len(recorder.Messages()))
+	}
+
+	// nothing new is due, even after a restart
+	scheduler = newScheduler()
+	err = scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 1 {
+		t.Fatalf("got %d messages after restarting, want 1", len(recorder.Messages()))
+	}
+
+	// the 24h reminder only pings players who haven't entered their attendance
+	now = gametime.Add(-time.Hour * 20)
+	err = scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := recorder.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+
+	mentions := messages[1].AllowedMentions.Users
+	if len(mentions) != 1 || mentions[0] != "d2" {
+		t.Errorf("mentions = %v, want [d2]", mentions)
+	}
+}
+
+func TestSchedulerReadsLegacyState(t *testing.T) {
+	b, _, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+	dir := t.TempDir()
+
+	// the 72h reminder was posted before teams had their own state file
+	legacy, err := json.Marshal(map[string]time.Time{reminderKey(gametime, time.Hour*72): gametime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "reminders.json"), legacy, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := &Scheduler{
+		Bot:             b,
+		Team:            b.Teams[0],
+		Session:         recorder,
+		ChannelID:       "reminders",
+		Offsets:         []time.Duration{time.Hour * 72},
+		StatePath:       filepath.Join(dir, "reminders-13313.json"),
+		LegacyStatePath: filepath.Join(dir, "reminders.json"),
+		Now:             func() time.Time { return gametime.Add(-time.Hour * 30) },
+	}
+
+	err = scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 0 {
+		t.Errorf("got %d messages, want the legacy reminder not to be posted again", len(recorder.Messages()))
+	}
+}
+
+func TestSchedulerRunStopsWhenCancelled(t *testing.T) {
+	b, _, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	scheduler := &Scheduler{
+		Bot:       b,
+		Team:      b.Teams[0],
+		Session:   recorder,
+		ChannelID: "reminders",
+		Offsets:   []time.Duration{time.Hour * 72},
+		StatePath: filepath.Join(t.TempDir(), "reminders.json"),
+		Interval:  time.Hour,
+		Now:       func() time.Time { return gametime.Add(-time.Hour * 30) },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run didn't return after cancelling ctx")
+	}
+}
+
+func TestSchedulerThresholdAlerts(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	// the team only has alerts, no reminder channel
+	scheduler := &Scheduler{
+		Bot:         b,
+		Team:        b.Teams[0],
+		Session:     recorder,
+		StatePath:   filepath.Join(t.TempDir(), "reminders.json"),
+		Threshold:   &ocua.GenderThreshold{Open: 2, Woman: 1},
+		AlertWindow: time.Hour * 72,
+		Now:         func() time.Time { return gametime.Add(-time.Hour * 30) },
+	}
+
+	// alex is the only player attending
+	err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := recorder.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+
+	if messages[0].ChannelID != "team-channel" {
+		t.Errorf("channel = %q, want the team's channel", messages[0].ChannelID)
+	}
+
+	content := messages[0].Content
+	for _, want := range []string{"need 1 more O and 1 more W (currently 1O, 0W)", "No O subs available", "W subs available to invite: <@d4>"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content = %q, want it to contain %q", content, want)
+		}
+	}
+
+	// the same shortfall isn't posted again
+	err = scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 1 {
+		t.Fatalf("got %d messages, want 1", len(recorder.Messages()))
+	}
+
+	// blair and emery are attending, only the O line is short now
+	date := gametime.Format("2006-01-02")
+	client.SetAttendance(context.Background(), "13313", "2", date, ocua.ATTENDING)
+	client.SetAttendance(context.Background(), "13313", "4", date, ocua.ATTENDING)
+
+	err = scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages = recorder.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+
+	content = messages[1].Content
+	if !strings.Contains(content, "need 1 more O (currently 1O, 2W)") || strings.Contains(content, "W subs") {
+		t.Errorf("content = %q, want only the O line", content)
+	}
+}
@@ -0,0 +1,23 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// Responder is the part of the discord session used to respond to interactions
+type Responder interface {
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// MessageSender is the part of the discord session used to post messages
+type MessageSender interface {
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// Session is everything the interaction handlers need from the discord session
+type Session interface {
+	Responder
+	MessageSender
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+}
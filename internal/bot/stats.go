@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/history"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+func formatLeadTime(stats *history.PlayerStats) string {
+	if stats.LeadTimeSet == 0 {
+		return "-"
+	}
+
+	days := stats.LeadTime.Hours() / 24
+	if days >= 1 {
+		return fmt.Sprintf("%.1fd", days)
+	}
+	return fmt.Sprintf("%.0fh", stats.LeadTime.Hours())
+}
+
+func formatStatsTable(stats map[string]*history.PlayerStats, team map[string]ocua.Player) string {
+	sorted := []*history.PlayerStats{}
+	for playerID, s := range stats {
+		if _, ok := team[playerID]; ok {
+			sorted = append(sorted, s)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Attended != sorted[j].Attended {
+			return sorted[i].Attended > sorted[j].Attended
+		}
+		return team[sorted[i].PlayerID].Name < team[sorted[j].PlayerID].Name
+	})
+
+	var sb strings.Builder
+	sb.WriteString("```\n")
+	sb.WriteString(fmt.Sprintf("%-20s %4s %4s %4s %6s\n", "Player", "In", "Out", "?", "Lead"))
+
+	for _, s := range sorted {
+		name := []rune(team[s.PlayerID].Name)
+		if len(name) > 20 {
+			name = name[:20]
+		}
+		sb.WriteString(fmt.Sprintf("%-20s %4d %4d %4d %6s\n", string(name), s.Attended, s.Missed, s.Unknown, formatLeadTime(s)))
+	}
+
+	sb.WriteString("```")
+	return sb.String()
+}
+
+func formatPlayerStats(stats *history.PlayerStats, player ocua.Player) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Season attendance for %s\n\n", player.Name))
+	sb.WriteString(fmt.Sprintf("Games attended: %d\n", stats.Attended))
+	sb.WriteString(fmt.Sprintf("Games missed: %d\n", stats.Missed))
+	sb.WriteString(fmt.Sprintf("Games left unknown: %d\n", stats.Unknown))
+
+	if stats.LeadTimeSet > 0 {
+		sb.WriteString(fmt.Sprintf("Average RSVP lead time: %s (over %d games)\n", formatLeadTime(stats), stats.LeadTimeSet))
+	} else {
+		sb.WriteString("Average RSVP lead time: unknown\n")
+	}
+
+	return sb.String()
+}
+
+func (b *Bot) generateStats(ctx context.Context, team *Team, playerID string) (string, error) {
+	players, attendance, err := b.fetchTeamAttendance(ctx, team.ID)
+	if err != nil {
+		return "failed to get team data", err
+	}
+
+	transitions := []history.Transition{}
+	if b.History != nil {
+		transitions, err = b.History.Transitions(team.ID, playerID)
+		if err != nil {
+			return "failed to get attendance history", err
+		}
+	}
+
+	stats := history.ComputeStats(attendance, players, transitions, time.Now())
+
+	if playerID == "" {
+		return formatStatsTable(stats, players), nil
+	}
+
+	player, ok := players[playerID]
+	if !ok {
+		return "failed to find player", fmt.Errorf("no player matching %q", playerID)
+	}
+
+	s, ok := stats[playerID]
+	if !ok {
+		s = &history.PlayerStats{PlayerID: playerID}
+	}
+
+	return formatPlayerStats(s, player), nil
+}
+
+func (b *Bot) HandleStatsCommand(s Responder, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		respondNoTeam(s, i)
+		return
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "calculating stats...",
+			Flags:   4,
+		},
+	})
+
+	playerID := getCommandOptions(i)["player"]
+
+	ctx, cancel := b.interactionContext()
+	defer cancel()
+
+	content, err := b.generateStats(ctx, team, playerID)
+	if err != nil {
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+		slog.Error(content, "err", err, "team", team.ID, "player", playerID)
+		return
+	}
+
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+
+	slog.Info("successfully handled stats command", "team", team.ID)
+}
+
+func (b *Bot) RegisterStatsCommand(dg *discordgo.Session) error {
+	_, err := dg.ApplicationCommandCreate(b.ApplicationID, "", &discordgo.ApplicationCommand{
+		Name:        "stats",
+		Description: "Season attendance stats for the team or a player",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:         "player",
+				Description:  "The player to show stats for",
+				Type:         discordgo.ApplicationCommandOptionString,
+				Required:     false,
+				Autocomplete: true,
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,237 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+func isSubstitute(player ocua.Player) bool {
+	return player.Role == "Substitute player"
+}
+
+// sub invite buttons have custom ids in the format "sub:<accept|decline>:<team id>:<player id>:<date>"
+func subResponseID(response, teamID, playerID, date string) string {
+	return strings.Join([]string{"sub", response, teamID, playerID, date}, ":")
+}
+
+func parseSubResponseID(customID string) (response, teamID, playerID, date string, err error) {
+	parts := strings.Split(customID, ":")
+	if len(parts) != 5 || parts[0] != "sub" {
+		return "", "", "", "", fmt.Errorf("invalid sub response id: %q", customID)
+	}
+	return parts[1], parts[2], parts[3], parts[4], nil
+}
+
+func formatSubInvite(player ocua.Player, week ocua.Attendance, teamID, playerID, date string) *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Content: fmt.Sprintf("Hi %s, you've been invited to sub on %s. Can you make it?", player.Name, formatGame(week)),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Accept",
+						Style:    discordgo.SuccessButton,
+						CustomID: subResponseID("accept", teamID, playerID, date),
+					},
+					discordgo.Button{
+						Label:    "Decline",
+						Style:    discordgo.DangerButton,
+						CustomID: subResponseID("decline", teamID, playerID, date),
+					},
+				},
+			},
+		},
+	}
+}
+
+// inviteSub invites the sub on OCUA then sends them a DM to accept or decline.
+// returns a message for the captain
+func (b *Bot) inviteSub(ctx context.Context, s Session, team *Team, playerID, date string) (string, error) {
+	players, attendance, err := b.fetchTeamAttendance(ctx, team.ID)
+	if err != nil {
+		return "failed to get team data", err
+	}
+
+	player, ok := players[playerID]
+	if !ok || !isSubstitute(player) {
+		return "failed to find substitute", fmt.Errorf("no substitute matching %q", playerID)
+	}
+
+	week, ok := ocua.FindWeek(attendance, date)
+	if !ok {
+		return "failed to find matching week", fmt.Errorf("no week matching %q", date)
+	}
+
+	// zuluru sends the invitation email when a captain sets a sub to invited
+	err = b.setAttendance(ctx, team.ID, playerID, date, ocua.INVITED)
+	if err != nil {
+		return "failed to invite substitute", err
+	}
+
+	discordID, ok := team.getDiscordID(playerID)
+	if !ok {
+		return fmt.Sprintf("invited %s for %s on OCUA, they aren't linked to a discord account so they weren't sent a DM", player.Name, week.Gametime.Format("Jan 2")), nil
+	}
+
+	channel, err := s.UserChannelCreate(discordID)
+	if err != nil {
+		return fmt.Sprintf("invited %s for %s on OCUA but failed to DM them", player.Name, week.Gametime.Format("Jan 2")), err
+	}
+
+	_, err = s.ChannelMessageSendComplex(channel.ID, formatSubInvite(player, week, team.ID, playerID, date))
+	if err != nil {
+		return fmt.Sprintf("invited %s for %s on OCUA but failed to DM them", player.Name, week.Gametime.Format("Jan 2")), err
+	}
+
+	return fmt.Sprintf("invited <@%s> for %s", discordID, week.Gametime.Format("Jan 2")), nil
+}
+
+func (b *Bot) HandleSubInviteCommand(s Session, i *discordgo.InteractionCreate) {
+	team, ok := b.getTeam(i)
+	if !ok {
+		respondNoTeam(s, i)
+		return
+	}
+
+	// inviting uses the captain's OCUA account and DMs the sub
+	if !b.canApprove(team, i) {
+		respondEphemeral(s, i, "only captains can invite substitutes")
+		return
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "inviting substitute...",
+			Flags:   4,
+		},
+	})
+
+	options := getCommandOptions(i)
+	date := options["week"] // week in "YYYY-mm-dd"
+	playerID := options["player"]
+
+	ctx, cancel := b.interactionContext()
+	defer cancel()
+
+	content, err := b.inviteSub(ctx, s, team, playerID, date)
+	if err != nil {
+		slog.Error(content, "err", err, "team", team.ID, "player", playerID, "date", date)
+	}
+
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{},
+		},
+	})
+
+	if err == nil {
+		slog.Info("successfully handled sub invite command", "team", team.ID, "player", playerID, "date", date)
+	}
+}
+
+// HandleSubResponse handles a sub pressing accept or decline on their invite DM
+func (b *Bot) HandleSubResponse(s Responder, i *discordgo.InteractionCreate) {
+	response, teamID, playerID, date, err := parseSubResponseID(i.MessageComponentData().CustomID)
+	if err != nil {
+		slog.Error("failed to parse sub response", "err", err)
+		return
+	}
+
+	// keep the buttons when the response fails so the sub can try again
+	buttons := []discordgo.MessageComponent{}
+	if i.Message != nil {
+		buttons = i.Message.Components
+	}
+
+	team, ok := findTeamByID(b.Teams, teamID)
+	if ok {
+		discordID, _ := team.getDiscordID(playerID)
+		ok = discordID == getInteractionUserID(i)
+	}
+
+	if !ok {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    "this invite isn't for you",
+				Components: buttons,
+			},
+		})
+		return
+	}
+
+	// changing attendance on OCUA takes longer than discord waits for a
+	// response, acknowledge the click then edit the invite once it's done
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+
+	respond := func(content string, components []discordgo.MessageComponent) {
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content:    &content,
+			Components: &components,
+		})
+	}
+
+	status := ocua.ABSENT
+	if response == "accept" {
+		status = ocua.ATTENDING
+	}
+
+	ctx, cancel := b.interactionContext()
+	defer cancel()
+
+	err = b.setAttendance(ctx, team.ID, playerID, date, status)
+	if err != nil {
+		respond("failed to update your attendance on OCUA, please try again", buttons)
+		slog.Error("failed to update sub attendance", "err", err, "team", team.ID, "player", playerID, "date", date)
+		return
+	}
+
+	if status == ocua.ATTENDING {
+		respond(fmt.Sprintf("Thanks! You're attending %s", date), []discordgo.MessageComponent{})
+	} else {
+		respond(fmt.Sprintf("No problem, you've declined %s", date), []discordgo.MessageComponent{})
+	}
+
+	slog.Info("successfully handled sub response", "team", team.ID, "player", playerID, "date", date, "status", status)
+}
+
+func (b *Bot) RegisterSubCommand(dg *discordgo.Session) error {
+	_, err := dg.ApplicationCommandCreate(b.ApplicationID, "", &discordgo.ApplicationCommand{
+		Name:        "sub",
+		Description: "Manage substitutes",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "invite",
+				Description: "Invite a substitute to a game",
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:         "week",
+						Description:  "The week to invite the substitute for",
+						Type:         discordgo.ApplicationCommandOptionString,
+						Required:     true,
+						Autocomplete: true,
+					},
+					{
+						Name:         "player",
+						Description:  "The substitute to invite",
+						Type:         discordgo.ApplicationCommandOptionString,
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Team is an OCUA team served by the bot. commands issued in ChannelID, or
+// anywhere in GuildID when no team claims the channel, are for this team. a team
+// with neither set is the default for any channel
+type Team struct {
+	ID        string
+	ChannelID string
+	GuildID   string
+	Players   map[string]string // map of ocua id -> discord id, changed with /link
+
+	mu sync.RWMutex // guards the fields above, which change on /link and config reloads
+}
+
+// location returns the channel and guild the team is linked to
+func (team *Team) location() (string, string) {
+	team.mu.RLock()
+	defer team.mu.RUnlock()
+	return team.ChannelID, team.GuildID
+}
+
+// copyPlayers copies a map of ocua id -> discord id. Players can be shared with
+// the config, which is read while reloading it, so the team only writes to copies
+func copyPlayers(players map[string]string) map[string]string {
+	copied := make(map[string]string, len(players))
+	for playerID, discordID := range players {
+		copied[playerID] = discordID
+	}
+	return copied
+}
+
+// update replaces the team's channel, guild and players
+func (team *Team) update(channelID, guildID string, players map[string]string) {
+	team.mu.Lock()
+	defer team.mu.Unlock()
+
+	team.ChannelID = channelID
+	team.GuildID = guildID
+	team.Players = copyPlayers(players)
+}
+
+// getPlayerID returns the ocua id of the player linked to a discord user
+func (team *Team) getPlayerID(discordID string) (string, bool) {
+	team.mu.RLock()
+	defer team.mu.RUnlock()
+
+	for playerID, id := range team.Players {
+		if id == discordID {
+			return playerID, true
+		}
+	}
+	return "", false
+}
+
+// getDiscordID returns the discord id of the user linked to a player
+func (team *Team) getDiscordID(playerID string) (string, bool) {
+	team.mu.RLock()
+	defer team.mu.RUnlock()
+
+	discordID, ok := team.Players[playerID]
+	return discordID, ok && discordID != ""
+}
+
+// players returns a copy of the ocua id -> discord id map
+func (team *Team) players() map[string]string {
+	team.mu.RLock()
+	defer team.mu.RUnlock()
+	return copyPlayers(team.Players)
+}
+
+// setDiscordID links a player to a discord user, an empty discord id unlinks them
+func (team *Team) setDiscordID(playerID, discordID string) {
+	team.mu.Lock()
+	defer team.mu.Unlock()
+
+	players := copyPlayers(team.Players)
+	if discordID == "" {
+		delete(players, playerID)
+	} else {
+		players[playerID] = discordID
+	}
+	team.Players = players
+}
+
+func findTeamByID(teams []*Team, teamID string) (*Team, bool) {
+	for _, team := range teams {
+		if team.ID == teamID {
+			return team, true
+		}
+	}
+	return nil, false
+}
+
+func findTeam(teams []*Team, channelID, guildID string) (*Team, bool) {
+	for _, team := range teams {
+		teamChannelID, _ := team.location()
+		if teamChannelID != "" && teamChannelID == channelID {
+			return team, true
+		}
+	}
+
+	for _, team := range teams {
+		teamChannelID, teamGuildID := team.location()
+		if teamChannelID == "" && teamGuildID != "" && teamGuildID == guildID {
+			return team, true
+		}
+	}
+
+	for _, team := range teams {
+		teamChannelID, teamGuildID := team.location()
+		if teamChannelID == "" && teamGuildID == "" {
+			return team, true
+		}
+	}
+
+	return nil, false
+}
+
+// getTeam returns the team for the channel the interaction was created in
+func (b *Bot) getTeam(i *discordgo.InteractionCreate) (*Team, bool) {
+	return findTeam(b.Teams, i.ChannelID, i.GuildID)
+}
+
+// UpdateTeam swaps in a new channel, guild and players for a team without
+// restarting. links saved with /link take precedence over the new players
+func (b *Bot) UpdateTeam(teamID, channelID, guildID string, players map[string]string) bool {
+	team, ok := findTeamByID(b.Teams, teamID)
+	if !ok {
+		return false
+	}
+
+	merged := map[string]string{}
+	for playerID, discordID := range players {
+		merged[playerID] = discordID
+	}
+
+	if b.Links != nil {
+		b.Links.overlay(teamID, merged)
+	}
+
+	team.update(channelID, guildID, merged)
+	return true
+}
+
+func respondNoTeam(s Responder, i *discordgo.InteractionCreate) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "this channel isn't linked to an OCUA team",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
@@ -0,0 +1,199 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/history"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// Watcher posts a message when players change their attendance for upcoming
+// games. it compares the team's snapshots instead of fetching from OCUA, so
+// changes are seen as often as the Prefetcher refreshes them. changes are held
+// until there haven't been any new ones for Coalesce so a burst of edits is
+// posted as one message
+type Watcher struct {
+	Bot       *Bot
+	Team      *Team
+	Session   MessageSender
+	ChannelID string
+	Interval  time.Duration    // time between checking the snapshot, defaults to 1 minute
+	Coalesce  time.Duration    // quiet period before posting, defaults to 5 minutes
+	Now       func() time.Time // clock, defaults to time.Now
+
+	prev       snapshot // last snapshot compared
+	pending    []history.Transition
+	lastChange time.Time
+}
+
+func describeTransition(transition history.Transition) string {
+	date := transition.Gametime.Format("Jan 2")
+
+	switch transition.To {
+	case ocua.ATTENDING:
+		return fmt.Sprintf("is attending %s", date)
+	case ocua.ABSENT:
+		if transition.From == ocua.ATTENDING {
+			return fmt.Sprintf("dropped out of %s", date)
+		}
+		return fmt.Sprintf("can't make %s", date)
+	case ocua.AVAILABLE:
+		return fmt.Sprintf("is available for %s", date)
+	case ocua.INVITED:
+		return fmt.Sprintf("was invited to %s", date)
+	case ocua.UNKNOWN:
+		return fmt.Sprintf("reset their attendance for %s", date)
+	}
+	return fmt.Sprintf("changed to %s for %s", strings.ToLower(string(transition.To)), date)
+}
+
+// coalesceTransitions merges the changes for each player and game into one
+// transition from the first status to the last, dropping changes that cancel out
+func coalesceTransitions(transitions []history.Transition) []history.Transition {
+	type key struct {
+		playerID string
+		gametime int64
+	}
+
+	merged := map[key]history.Transition{}
+	order := []key{}
+
+	for _, transition := range transitions {
+		k := key{transition.PlayerID, transition.Gametime.Unix()}
+
+		existing, ok := merged[k]
+		if !ok {
+			merged[k] = transition
+			order = append(order, k)
+			continue
+		}
+
+		existing.To = transition.To
+		existing.Time = transition.Time
+		merged[k] = existing
+	}
+
+	coalesced := []history.Transition{}
+	for _, k := range order {
+		transition := merged[k]
+		if transition.From != transition.To {
+			coalesced = append(coalesced, transition)
+		}
+	}
+
+	return coalesced
+}
+
+func formatTransitions(transitions []history.Transition, attendance []ocua.Attendance, team map[string]ocua.Player) string {
+	sorted := make([]history.Transition, len(transitions))
+	copy(sorted, transitions)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Gametime.Before(sorted[j].Gametime)
+	})
+
+	var sb strings.Builder
+	sb.WriteString("Attendance updates:\n")
+
+	for _, transition := range sorted {
+		name := transition.PlayerID
+		if player, ok := team[transition.PlayerID]; ok {
+			name = player.Name
+		}
+
+		line := fmt.Sprintf("- %s %s", name, describeTransition(transition))
+
+		week, ok := ocua.FindWeek(attendance, transition.Gametime.Format("2006-01-02"))
+		if ok {
+			report := ocua.GetAttendanceReport(week, team)
+			line += fmt.Sprintf(" (now %dO, %dW)", len(report.Open), len(report.Woman))
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	return sb.String()
+}
+
+func (watcher *Watcher) now() time.Time {
+	if watcher.Now != nil {
+		return watcher.Now()
+	}
+	return time.Now()
+}
+
+// RunOnce compares the team's snapshot with the last one it saw and posts the
+// pending changes once they have settled
+func (watcher *Watcher) RunOnce() error {
+	coalesce := watcher.Coalesce
+	if coalesce == 0 {
+		coalesce = time.Minute * 5
+	}
+
+	now := watcher.now()
+
+	// snapshots are dropped after writes, the next refresh has the change
+	snap, ok := watcher.Bot.getSnapshot(watcher.Team.ID)
+	if ok && !snap.fetched.Equal(watcher.prev.fetched) {
+		// only changes to upcoming games are interesting. players added to or
+		// removed from the roster didn't change their attendance
+		for _, transition := range history.Diff(watcher.prev.attendance, snap.attendance, now) {
+			if now.After(transition.Gametime) || transition.From == "" || transition.To == "" {
+				continue
+			}
+			watcher.pending = append(watcher.pending, transition)
+			watcher.lastChange = now
+		}
+		watcher.prev = snap
+	}
+
+	if len(watcher.pending) == 0 || now.Sub(watcher.lastChange) < coalesce {
+		return nil
+	}
+
+	transitions := coalesceTransitions(watcher.pending)
+	if len(transitions) == 0 {
+		watcher.pending = nil
+		return nil
+	}
+
+	_, err := watcher.Session.ChannelMessageSendComplex(watcher.ChannelID, &discordgo.MessageSend{
+		Content: formatTransitions(transitions, watcher.prev.attendance, watcher.prev.players),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	watcher.pending = nil
+
+	slog.Info("posted attendance updates", "team", watcher.Team.ID, "changes", len(transitions))
+	return nil
+}
+
+// Run checks the snapshot every Interval until ctx is cancelled
+func (watcher *Watcher) Run(ctx context.Context) {
+	interval := watcher.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	for {
+		err := watcher.RunOnce()
+		if err != nil {
+			slog.Error("failed to post attendance updates", "team", watcher.Team.ID, "err", err)
+		}
+
+		if !sleepContext(ctx, interval) {
+			return
+		}
+	}
+}
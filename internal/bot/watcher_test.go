@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/bot/bottest"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/history"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// setSnapshot saves the team's snapshot with the upcoming game's statuses
+// replaced by players
+func setSnapshot(b *Bot, client *fakeClient, fetched time.Time, players map[string]ocua.AttendanceStatus) {
+	attendance := make([]ocua.Attendance, len(client.attendance))
+	for i, week := range client.attendance {
+		statuses := map[string]ocua.AttendanceStatus{}
+		for playerID, status := range week.Players {
+			statuses[playerID] = status
+		}
+		if i == len(client.attendance)-1 {
+			for playerID, status := range players {
+				statuses[playerID] = status
+			}
+		}
+		attendance[i] = ocua.Attendance{Gametime: week.Gametime, Players: statuses}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.snapshots == nil {
+		b.snapshots = map[string]snapshot{}
+	}
+	b.snapshots["13313"] = snapshot{players: client.team, attendance: attendance, fetched: fetched}
+}
+
+func TestWatcherPostsSettledChanges(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	now := gametime.Add(-time.Hour * 24)
+	watcher := &Watcher{
+		Bot:       b,
+		Team:      b.Teams[0],
+		Session:   recorder,
+		ChannelID: "updates",
+		Now:       func() time.Time { return now },
+	}
+
+	// the first snapshot has nothing to compare against
+	setSnapshot(b, client, now, nil)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes wait for the quiet period
+	now = now.Add(time.Minute)
+	setSnapshot(b, client, now, map[string]ocua.AttendanceStatus{"2": ocua.ATTENDING, "3": ocua.ABSENT})
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 0 {
+		t.Fatalf("got %d messages before the changes settled, want 0", len(recorder.Messages()))
+	}
+
+	// the same snapshot isn't compared twice
+	now = now.Add(time.Minute * 2)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 0 {
+		t.Fatalf("got %d messages before the changes settled, want 0", len(recorder.Messages()))
+	}
+
+	// casey changes their mind before the changes are posted
+	setSnapshot(b, client, now, map[string]ocua.AttendanceStatus{"2": ocua.ATTENDING, "3": ocua.UNKNOWN})
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute * 5)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := recorder.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+
+	content := messages[0].Content
+	if !strings.Contains(content, "Blair is attending") || strings.Contains(content, "Casey") {
+		t.Errorf("content = %q, want only blair's change", content)
+	}
+
+	// nothing is posted again without new changes
+	now = now.Add(time.Minute * 10)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 1 {
+		t.Errorf("got %d messages, want 1", len(recorder.Messages()))
+	}
+}
+
+func TestWatcherIgnoresPastGames(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	// the upcoming game has started
+	now := gametime.Add(time.Hour)
+	watcher := &Watcher{
+		Bot:       b,
+		Team:      b.Teams[0],
+		Session:   recorder,
+		ChannelID: "updates",
+		Coalesce:  time.Minute,
+		Now:       func() time.Time { return now },
+	}
+
+	setSnapshot(b, client, now, nil)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	setSnapshot(b, client, now.Add(time.Minute), map[string]ocua.AttendanceStatus{"2": ocua.ABSENT})
+	now = now.Add(time.Hour)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 0 {
+		t.Errorf("got %d messages, want 0", len(recorder.Messages()))
+	}
+}
+
+func TestWatcherIgnoresRosterChanges(t *testing.T) {
+	b, client, gametime := newTestBot()
+	recorder := &bottest.Recorder{}
+
+	now := gametime.Add(-time.Hour * 24)
+	watcher := &Watcher{
+		Bot:       b,
+		Team:      b.Teams[0],
+		Session:   recorder,
+		ChannelID: "updates",
+		Coalesce:  time.Minute,
+		Now:       func() time.Time { return now },
+	}
+
+	setSnapshot(b, client, now, nil)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	// casey leaves the team and a new player joins
+	setSnapshot(b, client, now.Add(time.Minute), map[string]ocua.AttendanceStatus{"5": ocua.UNKNOWN})
+	b.Lock()
+	for _, week := range b.snapshots["13313"].attendance {
+		delete(week.Players, "3")
+	}
+	b.Unlock()
+
+	now = now.Add(time.Minute)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+	if err := watcher.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Messages()) != 0 {
+		t.Errorf("got %d messages, want 0: %q", len(recorder.Messages()), recorder.LastContent())
+	}
+}
+
+func TestFormatTransitions(t *testing.T) {
+	gametime := time.Date(2024, time.June, 3, 18, 45, 0, 0, time.Local)
+	team := map[string]ocua.Player{
+		"1": {ID: "1", Name: "Alex", Gender: "O"},
+		"2": {ID: "2", Name: "Blair", Gender: "W"},
+	}
+	attendance := []ocua.Attendance{
+		{Gametime: gametime, Players: map[string]ocua.AttendanceStatus{"1": ocua.ABSENT, "2": ocua.ATTENDING}},
+	}
+
+	transitions := []history.Transition{
+		{PlayerID: "1", Gametime: gametime, From: ocua.ATTENDING, To: ocua.ABSENT},
+		{PlayerID: "2", Gametime: gametime, From: ocua.UNKNOWN, To: ocua.ATTENDING},
+		{PlayerID: "9", Gametime: gametime, From: ocua.UNKNOWN, To: ocua.AVAILABLE},
+	}
+
+	expected := "Attendance updates:\n" +
+		"- Alex dropped out of Jun 3 (now 0O, 1W)\n" +
+		"- Blair is attending Jun 3 (now 0O, 1W)\n" +
+		"- 9 is available for Jun 3 (now 0O, 1W)\n"
+
+	content := formatTransitions(transitions, attendance, team)
+	if content != expected {
+		t.Errorf("content = %q, want %q", content, expected)
+	}
+}
@@ -0,0 +1,474 @@
+// Package config loads the bot's configuration file
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Version is the config file version this package understands
+const Version = 1
+
+type Config struct {
+	Version   int       `yaml:"version"`
+	OCUA      OCUA      `yaml:"ocua"`
+	Discord   Discord   `yaml:"discord"`
+	Reminders Reminders `yaml:"reminders"`
+	Cache     Cache     `yaml:"cache"`
+	Prefetch  Prefetch  `yaml:"prefetch"`
+	History   History   `yaml:"history"`
+	Links     Links     `yaml:"links"`
+	Alerts    Alerts    `yaml:"alerts"`
+	Logging   Logging   `yaml:"logging"`
+	Teams     []Team    `yaml:"teams"`
+}
+
+type OCUA struct {
+	BaseURL  string `yaml:"base_url"`
+	Username string `yaml:"username"` // overridden by $ocua_username
+	Password string `yaml:"password"` // overridden by $ocua_password
+	Client   string `yaml:"client"`   // "playwright" or "http"
+
+	// the session is saved to SessionPath encrypted with SessionKey so restarts
+	// don't need to log in again. an empty key disables saving the session
+	SessionPath string `yaml:"session_path"`
+	SessionKey  string `yaml:"session_key"` // base64 aes key, overridden by $ocua_session_key
+
+	StartupTimeout string `yaml:"startup_timeout"` // how long to wait for the first login, ex: "5m"
+}
+
+type Discord struct {
+	ApplicationID string `yaml:"application_id"`
+	GuildID       string `yaml:"guild_id"`
+	BotToken      string `yaml:"bot_token"` // overridden by $discord_bot_token
+}
+
+type Reminders struct {
+	Offsets  []string `yaml:"offsets"` // durations before each game, ex: "72h"
+	StateDir string   `yaml:"state_dir"`
+}
+
+type Cache struct {
+	TTL      string `yaml:"ttl"`       // how long pages are reused, ex: "1m"
+	MaxStale string `yaml:"max_stale"` // how long expired pages are returned while they're fetched again
+}
+
+// Prefetch is how often each team's data is refreshed in the background
+type Prefetch struct {
+	Interval     string `yaml:"interval"`      // ex: "15m"
+	GameInterval string `yaml:"game_interval"` // used within game_window of a game
+	GameWindow   string `yaml:"game_window"`
+	MaxBackoff   string `yaml:"max_backoff"` // longest wait after OCUA fails
+}
+
+type History struct {
+	Path string `yaml:"path"` // empty disables attendance history
+}
+
+type Links struct {
+	Path string `yaml:"path"` // discord accounts linked with /link
+}
+
+type Alerts struct {
+	AdminID       string `yaml:"admin_id"`       // discord user to DM when logging in to OCUA fails, empty disables alerts
+	AfterFailures int    `yaml:"after_failures"` // consecutive failed logins before alerting
+}
+
+type Logging struct {
+	Level  string `yaml:"level"`  // "debug", "info", "warn" or "error"
+	Format string `yaml:"format"` // "json" or "text"
+}
+
+type Team struct {
+	ID                string            `yaml:"id"`
+	ChannelID         string            `yaml:"channel_id"`
+	GuildID           string            `yaml:"guild_id"`
+	ReminderChannelID string            `yaml:"reminder_channel_id"`
+	NotifyChannelID   string            `yaml:"notify_channel_id"`
+	MinOpen           int               `yaml:"min_open"`
+	MinWoman          int               `yaml:"min_woman"`
+	CacheTTL          string            `yaml:"cache_ttl"` // overrides cache.ttl for the team
+	Players           map[string]string `yaml:"players"`   // map of ocua id -> discord id
+}
+
+// FieldError is a problem with the value of a config key
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+func (err FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Key, err.Message)
+}
+
+func defaults() *Config {
+	return &Config{
+		OCUA: OCUA{
+			BaseURL: "https://www.ocua.ca",
+			Client:  "playwright",
+
+			SessionPath: "./data/session.enc",
+
+			StartupTimeout: "5m",
+		},
+		Reminders: Reminders{
+			Offsets:  []string{"72h", "24h", "4h"},
+			StateDir: "./data",
+		},
+		Cache: Cache{
+			TTL:      "1m",
+			MaxStale: "10m",
+		},
+		Prefetch: Prefetch{
+			Interval:     "15m",
+			GameInterval: "2m",
+			GameWindow:   "6h",
+			MaxBackoff:   "1h",
+		},
+		Links: Links{
+			Path: "./data/links.json",
+		},
+		Alerts: Alerts{
+			AfterFailures: 3,
+		},
+		Logging: Logging{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// Load reads and validates the config file at path. secrets can be set with
+// environment variables instead of being written to the file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Parse parses and validates a config file, applying environment overrides
+func Parse(data []byte) (*Config, error) {
+	config := defaults()
+
+	err := yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	config.applyEnv()
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (config *Config) applyEnv() {
+	overrides := map[string]*string{
+		"ocua_username":     &config.OCUA.Username,
+		"ocua_password":     &config.OCUA.Password,
+		"ocua_session_key":  &config.OCUA.SessionKey,
+		"discord_bot_token": &config.Discord.BotToken,
+	}
+
+	for name, field := range overrides {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+}
+
+// Validate returns every problem with the config joined into one error
+func (config *Config) Validate() error {
+	errs := []error{}
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if config.Version != Version {
+		fail("version", "unsupported version %d, expected %d", config.Version, Version)
+	}
+
+	// ocua
+	if u, err := url.Parse(config.OCUA.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		fail("ocua.base_url", "must be an absolute url, got %q", config.OCUA.BaseURL)
+	}
+	if config.OCUA.Username == "" {
+		fail("ocua.username", "required (or set $ocua_username)")
+	}
+	if config.OCUA.Password == "" {
+		fail("ocua.password", "required (or set $ocua_password)")
+	}
+	if config.OCUA.Client != "playwright" && config.OCUA.Client != "http" {
+		fail("ocua.client", "must be \"playwright\" or \"http\", got %q", config.OCUA.Client)
+	}
+	if config.OCUA.SessionKey != "" {
+		if _, err := config.OCUA.DecodeSessionKey(); err != nil {
+			fail("ocua.session_key", "%s (or set $ocua_session_key)", err)
+		}
+		if config.OCUA.SessionPath == "" {
+			fail("ocua.session_path", "required when ocua.session_key is set")
+		}
+	}
+
+	if d, err := time.ParseDuration(config.OCUA.StartupTimeout); err != nil || d <= 0 {
+		fail("ocua.startup_timeout", "must be a positive duration like \"5m\", got %q", config.OCUA.StartupTimeout)
+	}
+
+	// discord
+	if config.Discord.ApplicationID == "" {
+		fail("discord.application_id", "required")
+	}
+	if config.Discord.BotToken == "" {
+		fail("discord.bot_token", "required (or set $discord_bot_token)")
+	}
+
+	// reminders
+	for i, offset := range config.Reminders.Offsets {
+		d, err := time.ParseDuration(offset)
+		if err != nil || d <= 0 {
+			fail(fmt.Sprintf("reminders.offsets[%d]", i), "must be a positive duration like \"24h\", got %q", offset)
+		}
+	}
+
+	// cache
+	ttl, err := time.ParseDuration(config.Cache.TTL)
+	if err != nil || ttl <= 0 {
+		fail("cache.ttl", "must be a positive duration like \"1m\", got %q", config.Cache.TTL)
+	}
+	maxStale, err := time.ParseDuration(config.Cache.MaxStale)
+	if err != nil || maxStale < 0 {
+		fail("cache.max_stale", "must be a duration like \"10m\", got %q", config.Cache.MaxStale)
+	} else if maxStale < ttl {
+		fail("cache.max_stale", "must be at least cache.ttl (%s), got %q", config.Cache.TTL, config.Cache.MaxStale)
+	}
+
+	// prefetch
+	prefetch := config.Prefetch.fields()
+	keys := make([]string, 0, len(prefetch))
+	for key := range prefetch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := prefetch[key]
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			fail("prefetch."+key, "must be a positive duration like \"15m\", got %q", value)
+		}
+	}
+
+	// links
+	if config.Links.Path == "" {
+		fail("links.path", "required")
+	}
+
+	// alerts
+	if config.Alerts.AfterFailures < 1 {
+		fail("alerts.after_failures", "must be at least 1, got %d", config.Alerts.AfterFailures)
+	}
+
+	// logging
+	switch strings.ToLower(config.Logging.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("logging.level", "must be debug, info, warn or error, got %q", config.Logging.Level)
+	}
+	if config.Logging.Format != "json" && config.Logging.Format != "text" {
+		fail("logging.format", "must be \"json\" or \"text\", got %q", config.Logging.Format)
+	}
+
+	// teams
+	if len(config.Teams) == 0 {
+		fail("teams", "at least one team is required")
+	}
+
+	teamIDs := map[string]bool{}
+	channelIDs := map[string]bool{}
+	defaultTeams := 0
+
+	for i, team := range config.Teams {
+		key := fmt.Sprintf("teams[%d]", i)
+
+		if team.ID == "" {
+			fail(key+".id", "required")
+		} else if teamIDs[team.ID] {
+			fail(key+".id", "duplicate team %q", team.ID)
+		}
+		teamIDs[team.ID] = true
+
+		if team.ChannelID != "" {
+			if channelIDs[team.ChannelID] {
+				fail(key+".channel_id", "channel %q is already used by another team", team.ChannelID)
+			}
+			channelIDs[team.ChannelID] = true
+		}
+
+		if team.ChannelID == "" && team.GuildID == "" {
+			defaultTeams++
+			if defaultTeams > 1 {
+				fail(key, "only one team can leave both channel_id and guild_id empty")
+			}
+		}
+
+		if team.MinOpen < 0 {
+			fail(key+".min_open", "must not be negative")
+		}
+		if team.MinWoman < 0 {
+			fail(key+".min_woman", "must not be negative")
+		}
+		if (team.MinOpen > 0 || team.MinWoman > 0) && team.ChannelID == "" && team.ReminderChannelID == "" {
+			fail(key+".min_open", "alerts are posted to channel_id or reminder_channel_id, set one of them")
+		}
+		if team.CacheTTL != "" {
+			if d, err := time.ParseDuration(team.CacheTTL); err != nil || d <= 0 {
+				fail(key+".cache_ttl", "must be a positive duration like \"1m\", got %q", team.CacheTTL)
+			}
+		}
+
+		for playerID := range team.Players {
+			if playerID == "" {
+				fail(key+".players", "player ids must not be empty")
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SelectTeam returns the team with the id, or the only team when id is empty.
+// tools that work on one team use it to pick from the config
+func (config *Config) SelectTeam(id string) (Team, error) {
+	if id == "" {
+		if len(config.Teams) != 1 {
+			return Team{}, fmt.Errorf("the config has %d teams, choose one by id", len(config.Teams))
+		}
+		return config.Teams[0], nil
+	}
+
+	for _, team := range config.Teams {
+		if team.ID == id {
+			return team, nil
+		}
+	}
+	return Team{}, fmt.Errorf("no team %q in the config", id)
+}
+
+// DecodeSessionKey returns the session encryption key, nil if it isn't set
+func (ocua OCUA) DecodeSessionKey() ([]byte, error) {
+	if ocua.SessionKey == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(ocua.SessionKey)
+	if err != nil {
+		return nil, errors.New("must be base64 encoded")
+	}
+
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, fmt.Errorf("must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+
+	return key, nil
+}
+
+// StartupTimeoutDuration returns the startup timeout. the config must be valid
+func (ocua OCUA) StartupTimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(ocua.StartupTimeout)
+	return d
+}
+
+// Durations returns the reminder offsets as durations. the config must be valid
+func (reminders Reminders) Durations() []time.Duration {
+	offsets := []time.Duration{}
+	for _, offset := range reminders.Offsets {
+		d, err := time.ParseDuration(offset)
+		if err == nil {
+			offsets = append(offsets, d)
+		}
+	}
+	return offsets
+}
+
+// TeamTTLs returns each team's cache ttl override. the config must be valid
+func (config *Config) TeamTTLs() map[string]time.Duration {
+	ttls := map[string]time.Duration{}
+	for _, team := range config.Teams {
+		if d, err := time.ParseDuration(team.CacheTTL); err == nil {
+			ttls[team.ID] = d
+		}
+	}
+	return ttls
+}
+
+// Durations returns the ttl and max staleness. the config must be valid
+func (cache Cache) Durations() (ttl, maxStale time.Duration) {
+	ttl, _ = time.ParseDuration(cache.TTL)
+	maxStale, _ = time.ParseDuration(cache.MaxStale)
+	return ttl, maxStale
+}
+
+func (prefetch Prefetch) fields() map[string]string {
+	return map[string]string{
+		"interval":      prefetch.Interval,
+		"game_interval": prefetch.GameInterval,
+		"game_window":   prefetch.GameWindow,
+		"max_backoff":   prefetch.MaxBackoff,
+	}
+}
+
+// PrefetchDurations are the prefetch settings as durations
+type PrefetchDurations struct {
+	Interval     time.Duration
+	GameInterval time.Duration
+	GameWindow   time.Duration
+	MaxBackoff   time.Duration
+}
+
+// Durations returns the prefetch settings as durations. the config must be valid
+func (prefetch Prefetch) Durations() PrefetchDurations {
+	parse := func(value string) time.Duration {
+		d, _ := time.ParseDuration(value)
+		return d
+	}
+
+	return PrefetchDurations{
+		Interval:     parse(prefetch.Interval),
+		GameInterval: parse(prefetch.GameInterval),
+		GameWindow:   parse(prefetch.GameWindow),
+		MaxBackoff:   parse(prefetch.MaxBackoff),
+	}
+}
+
+// Logger returns a logger writing to w with the configured level and format
+func (logging Logging) Logger(w io.Writer) *slog.Logger {
+	level := slog.LevelInfo
+	level.UnmarshalText([]byte(logging.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	if logging.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const validConfig = `
+version: 1
+ocua:
+  username: captain@example.com
+  password: hunter2
+discord:
+  application_id: "123"
+  bot_token: token
+reminders:
+  offsets: [48h, 2h]
+teams:
+  - id: "13313"
+    channel_id: "456"
+    min_open: 4
+    players:
+      "1001": "789"
+`
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.OCUA.BaseURL != "https://www.ocua.ca" || config.OCUA.Client != "playwright" {
+		t.Errorf("expected ocua defaults, got %+v", config.OCUA)
+	}
+
+	offsets := config.Reminders.Durations()
+	if len(offsets) != 2 || offsets[0] != time.Hour*48 || offsets[1] != time.Hour*2 {
+		t.Errorf("offsets = %v", offsets)
+	}
+
+	if config.Teams[0].Players["1001"] != "789" {
+		t.Errorf("players = %v", config.Teams[0].Players)
+	}
+
+	ttl, maxStale := config.Cache.Durations()
+	if ttl != time.Minute || maxStale != time.Minute*10 {
+		t.Errorf("cache = %v, %v, expected the defaults", ttl, maxStale)
+	}
+}
+
+func TestParseEnvOverrides(t *testing.T) {
+	t.Setenv("ocua_password", "from-env")
+	t.Setenv("discord_bot_token", "token-from-env")
+
+	config, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.OCUA.Password != "from-env" || config.Discord.BotToken != "token-from-env" {
+		t.Errorf("expected secrets from the environment, got %q and %q", config.OCUA.Password, config.Discord.BotToken)
+	}
+}
+
+func TestParseValidationErrors(t *testing.T) {
+	// clear any secrets from the developer's environment
+	for _, name := range []string{"ocua_username", "ocua_password", "discord_bot_token"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	data := strings.NewReplacer(
+		"version: 1", "version: 2",
+		"password: hunter2", "password: \"\"",
+		"[48h, 2h]", "[48h, soon]",
+		"id: \"13313\"", "id: \"\"",
+		"min_open: 4", "min_open: 4\n    cache_ttl: often",
+		"channel_id: \"456\"", "guild_id: \"456\"",
+	).Replace(validConfig)
+
+	_, err := Parse([]byte(data))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, key := range []string{"version", "ocua.password", "reminders.offsets[1]", "teams[0].id", "teams[0].cache_ttl", "teams[0].min_open"} {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("error doesn't mention %q:\n%s", key, err)
+		}
+	}
+
+	var fieldErr FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Errorf("expected a FieldError, got %T", err)
+	}
+}
+
+func TestSelectTeam(t *testing.T) {
+	config, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the only team is picked without an id
+	team, err := config.SelectTeam("")
+	if err != nil || team.ID != "13313" {
+		t.Errorf("SelectTeam(\"\") = %q, %v, want 13313", team.ID, err)
+	}
+
+	config.Teams = append(config.Teams, Team{ID: "2"})
+
+	if _, err := config.SelectTeam(""); err == nil {
+		t.Error("expected an error choosing between two teams without an id")
+	}
+
+	team, err = config.SelectTeam("2")
+	if err != nil || team.ID != "2" {
+		t.Errorf("SelectTeam(\"2\") = %q, %v, want 2", team.ID, err)
+	}
+
+	if _, err := config.SelectTeam("3"); err == nil {
+		t.Error("expected an error for a team that isn't in the config")
+	}
+}
+
+func TestParseUnknownKey(t *testing.T) {
+	_, err := Parse([]byte(validConfig + "  - id: \"2\"\n    channel: \"1\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "channel") {
+		t.Errorf("expected an unknown key error, got %v", err)
+	}
+}
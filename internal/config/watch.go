@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Change is a config key whose value changed between two configs
+type Change struct {
+	Key  string
+	From string // empty when the key was added
+	To   string // empty when the key was removed
+}
+
+// secret keys are logged without their values
+var secrets = map[string]bool{
+	"ocua.username":     true,
+	"ocua.password":     true,
+	"ocua.session_key":  true,
+	"discord.bot_token": true,
+}
+
+func (change Change) String() string {
+	if secrets[change.Key] {
+		return fmt.Sprintf("%s changed", change.Key)
+	}
+	return fmt.Sprintf("%s: %q -> %q", change.Key, change.From, change.To)
+}
+
+// flatten returns the value of every key in the config. teams are keyed by
+// their id instead of their index so reordering teams isn't a change
+func (config *Config) flatten() map[string]string {
+	values := map[string]string{
+		"version":                strconv.Itoa(config.Version),
+		"ocua.base_url":          config.OCUA.BaseURL,
+		"ocua.username":          config.OCUA.Username,
+		"ocua.password":          config.OCUA.Password,
+		"ocua.client":            config.OCUA.Client,
+		"ocua.session_path":      config.OCUA.SessionPath,
+		"ocua.session_key":       config.OCUA.SessionKey,
+		"ocua.startup_timeout":   config.OCUA.StartupTimeout,
+		"discord.application_id": config.Discord.ApplicationID,
+		"discord.guild_id":       config.Discord.GuildID,
+		"discord.bot_token":      config.Discord.BotToken,
+		"reminders.offsets":      strings.Join(config.Reminders.Offsets, ","),
+		"reminders.state_dir":    config.Reminders.StateDir,
+		"cache.ttl":              config.Cache.TTL,
+		"cache.max_stale":        config.Cache.MaxStale,
+		"history.path":           config.History.Path,
+		"links.path":             config.Links.Path,
+		"alerts.admin_id":        config.Alerts.AdminID,
+		"alerts.after_failures":  strconv.Itoa(config.Alerts.AfterFailures),
+		"logging.level":          config.Logging.Level,
+		"logging.format":         config.Logging.Format,
+	}
+
+	for key, value := range config.Prefetch.fields() {
+		values["prefetch."+key] = value
+	}
+
+	for _, team := range config.Teams {
+		key := fmt.Sprintf("teams[%s]", team.ID)
+		values[key] = team.ID
+		values[key+".channel_id"] = team.ChannelID
+		values[key+".guild_id"] = team.GuildID
+		values[key+".reminder_channel_id"] = team.ReminderChannelID
+		values[key+".notify_channel_id"] = team.NotifyChannelID
+		values[key+".min_open"] = strconv.Itoa(team.MinOpen)
+		values[key+".min_woman"] = strconv.Itoa(team.MinWoman)
+		values[key+".cache_ttl"] = team.CacheTTL
+
+		for playerID, discordID := range team.Players {
+			values[fmt.Sprintf("%s.players[%s]", key, playerID)] = discordID
+		}
+	}
+
+	return values
+}
+
+// Diff returns the keys that changed between two configs sorted by key
+func Diff(prev, next *Config) []Change {
+	before := prev.flatten()
+	after := next.flatten()
+
+	changes := []Change{}
+	for key, from := range before {
+		if to, ok := after[key]; !ok || to != from {
+			changes = append(changes, Change{Key: key, From: from, To: to})
+		}
+	}
+
+	for key, to := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, Change{Key: key, To: to})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// Watcher polls the config file and calls OnChange with each new valid config.
+// invalid files are logged and the current config is kept. OnChange returns the
+// config that was applied, which becomes Current so changes that weren't
+// applied are reported again by the next reload
+type Watcher struct {
+	Path     string
+	Current  *Config
+	Interval time.Duration                                      // time between checks, defaults to 10 seconds
+	OnChange func(prev, next *Config, changes []Change) *Config // defaults to applying next
+
+	data []byte // contents of the file when it was last checked
+}
+
+// Check reloads the config if the file changed since it was last checked
+func (watcher *Watcher) Check() error {
+	data, err := os.ReadFile(watcher.Path)
+	if err != nil {
+		return err
+	}
+
+	// skip unchanged files, invalid files are only reported once
+	if bytes.Equal(data, watcher.data) {
+		return nil
+	}
+	watcher.data = data
+
+	next, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("invalid config %s: %w", watcher.Path, err)
+	}
+
+	changes := Diff(watcher.Current, next)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if watcher.OnChange == nil {
+		watcher.Current = next
+		return nil
+	}
+
+	watcher.Current = watcher.OnChange(watcher.Current, next, changes)
+	return nil
+}
+
+// Run checks the file every Interval until ctx is cancelled
+func (watcher *Watcher) Run(ctx context.Context) {
+	interval := watcher.Interval
+	if interval == 0 {
+		interval = time.Second * 10
+	}
+
+	for {
+		err := watcher.Check()
+		if err != nil {
+			slog.Error("failed to reload config, keeping the current config", "err", err, "path", watcher.Path)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	prev, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := Parse([]byte(strings.NewReplacer(
+		"password: hunter2", "password: hunter3",
+		`"1001": "789"`, `"1002": "790"`,
+	).Replace(validConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Diff(prev, next)
+
+	got := []string{}
+	for _, change := range changes {
+		got = append(got, change.String())
+	}
+
+	want := []string{
+		`ocua.password changed`,
+		`teams[13313].players[1001]: "789" -> ""`,
+		`teams[13313].players[1002]: "" -> "790"`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(data string) {
+		err := os.WriteFile(path, []byte(data), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(validConfig)
+	current, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := 0
+	watcher := &Watcher{
+		Path:    path,
+		Current: current,
+		OnChange: func(prev, next *Config, changes []Change) *Config {
+			reloads++
+			return next
+		},
+	}
+
+	// unchanged
+	if err := watcher.Check(); err != nil || reloads != 0 {
+		t.Fatalf("err = %v, reloads = %d", err, reloads)
+	}
+
+	// invalid files are rejected and the current config is kept
+	write(strings.Replace(validConfig, "[48h, 2h]", "[48h, soon]", 1))
+	err = watcher.Check()
+	if err == nil || !strings.Contains(err.Error(), "reminders.offsets[1]") {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if watcher.Current != current || reloads != 0 {
+		t.Fatal("expected the current config to be kept")
+	}
+
+	// valid changes are applied
+	write(strings.Replace(validConfig, `"1001": "789"`, `"1001": "999"`, 1))
+	if err := watcher.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 1 || watcher.Current.Teams[0].Players["1001"] != "999" {
+		t.Fatalf("expected the new config to be applied, reloads = %d", reloads)
+	}
+}
+
+func TestWatcherKeepsUnappliedChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(data string) {
+		err := os.WriteFile(path, []byte(data), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(validConfig)
+	current, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is applied
+	seen := [][]Change{}
+	watcher := &Watcher{
+		Path:    path,
+		Current: current,
+		OnChange: func(prev, next *Config, changes []Change) *Config {
+			seen = append(seen, changes)
+			return prev
+		},
+	}
+
+	write(strings.Replace(validConfig, `"1001": "789"`, `"1001": "999"`, 1))
+	if err := watcher.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if watcher.Current != current {
+		t.Fatal("expected the current config to be kept")
+	}
+
+	// the next reload still reports the first change
+	write(strings.Replace(strings.Replace(validConfig, `"1001": "789"`, `"1001": "999"`, 1), "[48h, 2h]", "[48h, 4h]", 1))
+	if err := watcher.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || len(seen[1]) != 2 {
+		t.Fatalf("changes = %v, want both changes on the second reload", seen)
+	}
+}
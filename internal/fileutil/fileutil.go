@@ -0,0 +1,31 @@
+// Package fileutil has helpers for the files the bot keeps its state in
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to path, creating its directory if needed. the
+// data is written to a temporary file then renamed so a crash never leaves a
+// partial file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, "."+filepath.Base(path)+".tmp")
+	err = os.WriteFile(tmp, data, perm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package history
+
+import (
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// PlayerStats is a player's attendance over the games that have been played
+type PlayerStats struct {
+	PlayerID string
+	Attended int
+	Missed   int
+	Unknown  int // games the player never entered their attendance for, not counted for substitutes
+
+	// average time before the game the player entered their attendance. only
+	// known for games where the change was recorded by the store
+	LeadTime    time.Duration
+	LeadTimeSet int // number of games LeadTime is averaged over
+}
+
+// ComputeStats returns the stats for every player in the attendance. only games
+// before now are counted. substitutes in team are listed on every game but only
+// expected to answer when they're invited, so their unknown games aren't counted
+func ComputeStats(weeks []ocua.Attendance, team map[string]ocua.Player, transitions []Transition, now time.Time) map[string]*PlayerStats {
+	stats := map[string]*PlayerStats{}
+
+	get := func(playerID string) *PlayerStats {
+		s, ok := stats[playerID]
+		if !ok {
+			s = &PlayerStats{PlayerID: playerID}
+			stats[playerID] = s
+		}
+		return s
+	}
+
+	played := map[int64]bool{}
+
+	for _, week := range weeks {
+		if week.Gametime.IsZero() || now.Before(week.Gametime) {
+			continue
+		}
+		played[week.Gametime.Unix()] = true
+
+		for playerID, status := range week.Players {
+			switch status {
+			case ocua.ATTENDING:
+				get(playerID).Attended++
+			case ocua.ABSENT:
+				get(playerID).Missed++
+			case ocua.UNKNOWN:
+				if team[playerID].Role != "Substitute player" {
+					get(playerID).Unknown++
+				}
+			}
+		}
+	}
+
+	// the first time a player entered their attendance for each game
+	type key struct {
+		playerID string
+		gametime int64
+	}
+
+	entered := map[key]Transition{}
+	for _, transition := range transitions {
+		k := key{transition.PlayerID, transition.Gametime.Unix()}
+		if !played[k.gametime] {
+			continue
+		}
+
+		if transition.From != ocua.UNKNOWN && transition.From != "" {
+			continue
+		}
+
+		if transition.To == ocua.UNKNOWN || transition.To == ocua.INVITED {
+			continue
+		}
+
+		if _, ok := entered[k]; !ok {
+			entered[k] = transition
+		}
+	}
+
+	total := map[string]time.Duration{}
+	for k, transition := range entered {
+		lead := transition.Gametime.Sub(transition.Time)
+		if lead < 0 {
+			continue
+		}
+
+		s := get(k.playerID)
+		total[k.playerID] += lead
+		s.LeadTimeSet++
+	}
+
+	for playerID, sum := range total {
+		s := stats[playerID]
+		s.LeadTime = sum / time.Duration(s.LeadTimeSet)
+	}
+
+	return stats
+}
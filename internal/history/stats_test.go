@@ -0,0 +1,61 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+func TestComputeStats(t *testing.T) {
+	weeks := []ocua.Attendance{
+		week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.ABSENT, "3": ocua.UNKNOWN, "4": ocua.UNKNOWN}),
+		week(game2, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.ATTENDING, "3": ocua.UNKNOWN, "4": ocua.ATTENDING}),
+		week(game2.AddDate(0, 0, 7), map[string]ocua.AttendanceStatus{"1": ocua.ABSENT}), // not played yet
+	}
+
+	transitions := []Transition{
+		{PlayerID: "1", Gametime: game1, From: ocua.UNKNOWN, To: ocua.ATTENDING, Time: game1.Add(-time.Hour * 48)},
+		{PlayerID: "1", Gametime: game2, From: ocua.UNKNOWN, To: ocua.ATTENDING, Time: game2.Add(-time.Hour * 24)},
+		// changing their mind doesn't move when they first entered it
+		{PlayerID: "1", Gametime: game2, From: ocua.ATTENDING, To: ocua.ABSENT, Time: game2.Add(-time.Hour * 2)},
+		{PlayerID: "2", Gametime: game1, From: "", To: ocua.ABSENT, Time: game1.Add(-time.Hour * 6)},
+	}
+
+	team := map[string]ocua.Player{
+		"1": {ID: "1", Role: "Captain"},
+		"2": {ID: "2", Role: "Regular player"},
+		"3": {ID: "3", Role: "Regular player"},
+		"4": {ID: "4", Role: "Substitute player"},
+	}
+
+	now := game2.Add(time.Hour * 2)
+	stats := ComputeStats(weeks, team, transitions, now)
+
+	tests := []struct {
+		playerID                  string
+		attended, missed, unknown int
+		leadTime                  time.Duration
+	}{
+		{"1", 2, 0, 0, time.Hour * 36},
+		{"2", 1, 1, 0, time.Hour * 6},
+		{"3", 0, 0, 2, 0},
+		{"4", 1, 0, 0, 0}, // subs aren't expected to answer for every game
+	}
+
+	for _, test := range tests {
+		s, ok := stats[test.playerID]
+		if !ok {
+			t.Errorf("no stats for player %s", test.playerID)
+			continue
+		}
+
+		if s.Attended != test.attended || s.Missed != test.missed || s.Unknown != test.unknown {
+			t.Errorf("player %s = %dA/%dM/%dU, want %dA/%dM/%dU", test.playerID, s.Attended, s.Missed, s.Unknown, test.attended, test.missed, test.unknown)
+		}
+
+		if s.LeadTime != test.leadTime {
+			t.Errorf("player %s lead time = %s, want %s", test.playerID, s.LeadTime, test.leadTime)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	snapshotsBucket   = []byte("snapshots")
+	transitionsBucket = []byte("transitions")
+)
+
+// Snapshot is the attendance of a team at a point in time
+type Snapshot struct {
+	Time       time.Time
+	Attendance []ocua.Attendance
+}
+
+// Transition is a change to a player's attendance for a game
+type Transition struct {
+	PlayerID string
+	Gametime time.Time
+	From     ocua.AttendanceStatus // empty if the player wasn't on the team
+	To       ocua.AttendanceStatus // empty if the player was removed from the team
+	Time     time.Time             // when the change was first seen
+}
+
+// Store is an embedded database of attendance snapshots and the transitions
+// between them. each team has a bucket with a snapshots and transitions bucket
+type Store struct {
+	db *bolt.DB
+}
+
+func Open(path string) (*Store, error) {
+	// the default ./data isn't created by anything else on a fresh checkout
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// snapshotWeeks returns the parts of the attendance that are saved in
+// snapshots. change urls and games aren't attendance and would make identical
+// attendance look different
+func snapshotWeeks(attendance []ocua.Attendance) []ocua.Attendance {
+	weeks := make([]ocua.Attendance, len(attendance))
+	for i, week := range attendance {
+		weeks[i] = ocua.Attendance{Gametime: week.Gametime, Players: week.Players}
+	}
+	return weeks
+}
+
+// Diff returns the status changes between two attendance fetches. weeks that
+// aren't in prev have nothing to compare against and are skipped
+func Diff(prev, next []ocua.Attendance, t time.Time) []Transition {
+	prevWeeks := map[int64]ocua.Attendance{}
+	for _, week := range prev {
+		prevWeeks[week.Gametime.Unix()] = week
+	}
+
+	transitions := []Transition{}
+	for _, week := range next {
+		prevWeek, ok := prevWeeks[week.Gametime.Unix()]
+		if !ok {
+			continue
+		}
+
+		for playerID, status := range week.Players {
+			if prevWeek.Players[playerID] == status {
+				continue
+			}
+
+			transitions = append(transitions, Transition{
+				PlayerID: playerID,
+				Gametime: week.Gametime,
+				From:     prevWeek.Players[playerID],
+				To:       status,
+				Time:     t,
+			})
+		}
+
+		// players removed from the roster
+		for playerID, status := range prevWeek.Players {
+			if _, ok := week.Players[playerID]; ok {
+				continue
+			}
+
+			transitions = append(transitions, Transition{
+				PlayerID: playerID,
+				Gametime: week.Gametime,
+				From:     status,
+				To:       "",
+				Time:     t,
+			})
+		}
+	}
+
+	return transitions
+}
+
+// Record saves a snapshot of the team's attendance if it differs from the last
+// one and returns the transitions since the last snapshot
+func (store *Store) Record(teamID string, attendance []ocua.Attendance, t time.Time) ([]Transition, error) {
+	data, err := json.Marshal(snapshotWeeks(attendance))
+	if err != nil {
+		return nil, err
+	}
+
+	transitions := []Transition{}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		team, err := tx.CreateBucketIfNotExists([]byte(teamID))
+		if err != nil {
+			return err
+		}
+
+		snapshots, err := team.CreateBucketIfNotExists(snapshotsBucket)
+		if err != nil {
+			return err
+		}
+
+		history, err := team.CreateBucketIfNotExists(transitionsBucket)
+		if err != nil {
+			return err
+		}
+
+		// compare with the latest snapshot
+		_, latest := snapshots.Cursor().Last()
+		if latest != nil {
+			if bytes.Equal(latest, data) {
+				return nil
+			}
+
+			prev := []ocua.Attendance{}
+			err = json.Unmarshal(latest, &prev)
+			if err != nil {
+				return err
+			}
+
+			transitions = Diff(prev, attendance, t)
+		}
+
+		for _, transition := range transitions {
+			value, err := json.Marshal(transition)
+			if err != nil {
+				return err
+			}
+
+			seq, err := history.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			err = history.Put(sequenceKey(seq), value)
+			if err != nil {
+				return err
+			}
+		}
+
+		return snapshots.Put(timeKey(t), data)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return transitions, nil
+}
+
+// Latest returns the most recent snapshot of the team's attendance
+func (store *Store) Latest(teamID string) (Snapshot, bool, error) {
+	snapshot := Snapshot{}
+	found := false
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		team := tx.Bucket([]byte(teamID))
+		if team == nil {
+			return nil
+		}
+
+		key, value := team.Bucket(snapshotsBucket).Cursor().Last()
+		if key == nil {
+			return nil
+		}
+
+		found = true
+		snapshot.Time = time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+		return json.Unmarshal(value, &snapshot.Attendance)
+	})
+
+	return snapshot, found, err
+}
+
+// Transitions returns every recorded transition for the team in the order they
+// were seen. if playerID isn't empty only that player's transitions are returned
+func (store *Store) Transitions(teamID, playerID string) ([]Transition, error) {
+	transitions := []Transition{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		team := tx.Bucket([]byte(teamID))
+		if team == nil {
+			return nil
+		}
+
+		return team.Bucket(transitionsBucket).ForEach(func(key, value []byte) error {
+			transition := Transition{}
+			err := json.Unmarshal(value, &transition)
+			if err != nil {
+				return err
+			}
+
+			if playerID == "" || transition.PlayerID == playerID {
+				transitions = append(transitions, transition)
+			}
+			return nil
+		})
+	})
+
+	return transitions, err
+}
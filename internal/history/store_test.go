@@ -0,0 +1,174 @@
+package history
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+var (
+	game1 = time.Date(2024, 5, 20, 18, 45, 0, 0, time.UTC)
+	game2 = time.Date(2024, 5, 27, 18, 45, 0, 0, time.UTC)
+)
+
+func week(gametime time.Time, players map[string]ocua.AttendanceStatus) ocua.Attendance {
+	return ocua.Attendance{Gametime: gametime, Players: players}
+}
+
+// sortTransitions orders transitions by game then player so they can be compared
+func sortTransitions(transitions []Transition) {
+	sort.Slice(transitions, func(i, j int) bool {
+		if !transitions[i].Gametime.Equal(transitions[j].Gametime) {
+			return transitions[i].Gametime.Before(transitions[j].Gametime)
+		}
+		return transitions[i].PlayerID < transitions[j].PlayerID
+	})
+}
+
+func TestDiff(t *testing.T) {
+	now := game1.Add(-time.Hour * 24)
+
+	tests := []struct {
+		name string
+		prev []ocua.Attendance
+		next []ocua.Attendance
+		want []Transition
+	}{
+		{
+			name: "no changes",
+			prev: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING})},
+			next: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING})},
+			want: []Transition{},
+		},
+		{
+			name: "status changed",
+			prev: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.UNKNOWN, "2": ocua.ATTENDING})},
+			next: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ABSENT, "2": ocua.ATTENDING})},
+			want: []Transition{{PlayerID: "1", Gametime: game1, From: ocua.UNKNOWN, To: ocua.ABSENT, Time: now}},
+		},
+		{
+			name: "player added to the roster",
+			prev: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING})},
+			next: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.UNKNOWN})},
+			want: []Transition{{PlayerID: "2", Gametime: game1, From: "", To: ocua.UNKNOWN, Time: now}},
+		},
+		{
+			name: "player removed from the roster",
+			prev: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.ABSENT})},
+			next: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING})},
+			want: []Transition{{PlayerID: "2", Gametime: game1, From: ocua.ABSENT, To: "", Time: now}},
+		},
+		{
+			name: "new week",
+			prev: []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING})},
+			next: []ocua.Attendance{
+				week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING}),
+				week(game2, map[string]ocua.AttendanceStatus{"1": ocua.UNKNOWN}),
+			},
+			want: []Transition{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Diff(test.prev, test.next, now)
+			sortTransitions(got)
+
+			if len(got) != len(test.want) {
+				t.Fatalf("Diff() = %+v, want %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("transition %d = %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	start := game1.Add(-time.Hour * 72)
+
+	steps := []struct {
+		name       string
+		attendance []ocua.Attendance
+		want       int // transitions
+	}{
+		{"first snapshot", []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.UNKNOWN, "2": ocua.UNKNOWN})}, 0},
+		{"player enters attendance", []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.UNKNOWN})}, 1},
+		{"unchanged", []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING, "2": ocua.UNKNOWN})}, 0},
+		{"player removed", []ocua.Attendance{week(game1, map[string]ocua.AttendanceStatus{"1": ocua.ATTENDING})}, 1},
+	}
+
+	for i, step := range steps {
+		transitions, err := store.Record("2001", step.attendance, start.Add(time.Hour*time.Duration(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transitions) != step.want {
+			t.Errorf("%s: got %d transitions, want %d", step.name, len(transitions), step.want)
+		}
+	}
+
+	transitions, err := store.Transitions("2001", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transitions) != 2 {
+		t.Fatalf("got %d saved transitions, want 2", len(transitions))
+	}
+	if transitions[1].PlayerID != "2" || transitions[1].To != "" {
+		t.Errorf("transition = %+v, want player 2 removed", transitions[1])
+	}
+
+	snapshot, ok, err := store.Latest("2001")
+	if err != nil || !ok {
+		t.Fatalf("Latest() = %v, %v", ok, err)
+	}
+	if len(snapshot.Attendance) != 1 || len(snapshot.Attendance[0].Players) != 1 {
+		t.Errorf("latest snapshot = %+v, want the last attendance", snapshot.Attendance)
+	}
+}
+
+func TestRecordIgnoresChangeURLs(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	attendance := func(changeURL string) []ocua.Attendance {
+		return []ocua.Attendance{{
+			Gametime:   game1,
+			Players:    map[string]ocua.AttendanceStatus{"1": ocua.UNKNOWN},
+			ChangeURLs: map[string]string{"1": changeURL},
+		}}
+	}
+
+	for i, changeURL := range []string{"/change?token=a", "/change?token=b"} {
+		_, err := store.Record("2001", attendance(changeURL), game1.Add(time.Hour*time.Duration(i-10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot, _, err := store.Latest("2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Attendance[0].ChangeURLs != nil {
+		t.Errorf("change urls = %v, want them left out of snapshots", snapshot.Attendance[0].ChangeURLs)
+	}
+	if !snapshot.Time.Equal(game1.Add(-time.Hour * 10)) {
+		t.Errorf("latest snapshot from %s, want the first since the attendance didn't change", snapshot.Time)
+	}
+}
@@ -0,0 +1,118 @@
+package ocua
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/playwright-community/playwright-go"
+)
+
+// zuluru attendance status codes used by the attendance change form
+var attendanceStatusCodes = map[AttendanceStatus]string{
+	UNKNOWN:   "0",
+	ATTENDING: "1",
+	ABSENT:    "2",
+	INVITED:   "3",
+	AVAILABLE: "4",
+}
+
+func getAttendanceStatusCode(status AttendanceStatus) (string, error) {
+	code, ok := attendanceStatusCodes[status]
+	if !ok {
+		return "", fmt.Errorf("unsupported attendance status: %q", status)
+	}
+	return code, nil
+}
+
+func getAttendanceChangeURL(weeks []Attendance, playerID, date string) (string, error) {
+	week, ok := FindWeek(weeks, date)
+	if !ok {
+		return "", fmt.Errorf("failed to find week: %q", date)
+	}
+
+	changeURL, ok := week.ChangeURLs[playerID]
+	if !ok {
+		return "", fmt.Errorf("player %q can't change attendance for %q", playerID, date)
+	}
+
+	return changeURL, nil
+}
+
+// checkAttendanceChangeResult checks the page zuluru shows after submitting the
+// attendance change form. an error message or the form shown again means the
+// change wasn't saved
+func checkAttendanceChangeResult(page io.Reader) error {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return err
+	}
+
+	message := strings.TrimSpace(doc.Find(".messages.error, .alert-danger, #flashMessage.error, .error-message").First().Text())
+	if message != "" {
+		return fmt.Errorf("%w: attendance change failed: %s", ErrUnexpectedPage, message)
+	}
+
+	if doc.Find("input[name=status]").Length() > 0 {
+		return fmt.Errorf("%w: still on the attendance change form after submitting it", ErrUnexpectedPage)
+	}
+
+	return nil
+}
+
+// ChangeAttendance submits the zuluru attendance change form found at changeURL
+func ChangeAttendance(ctx context.Context, changeURL string, status AttendanceStatus, browserContext playwright.BrowserContext) error {
+	code, err := getAttendanceStatusCode(status)
+	if err != nil {
+		return err
+	}
+
+	page, closePage, err := newPage(ctx, browserContext)
+	if err != nil {
+		return err
+	}
+	defer closePage()
+
+	res, err := page.Goto(changeURL)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = checkPageResponse(changeURL, res, page)
+	if err != nil {
+		return err
+	}
+
+	err = page.Locator(fmt.Sprintf("input[name=\"status\"][value=\"%s\"]", code)).First().Check()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	// clicking waits for the navigation to start, then wait for the next page to load
+	err = page.Locator("form input[type=\"submit\"], form button[type=\"submit\"]").First().Click()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
+		State: playwright.LoadStateLoad,
+	})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = checkResponse(changeURL, http.StatusOK, page.URL())
+	if err != nil {
+		return err
+	}
+
+	content, err := page.Content()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return checkAttendanceChangeResult(strings.NewReader(content))
+}
@@ -2,6 +2,7 @@ package ocua
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/url"
@@ -21,8 +22,10 @@ const (
 )
 
 type Attendance struct {
-	Gametime time.Time
-	Players  map[string]AttendanceStatus
+	Gametime   time.Time
+	Players    map[string]AttendanceStatus
+	ChangeURLs map[string]string // map of player id -> attendance change url
+	Game       *Game             // set by JoinSchedule, nil if the game isn't on the schedule
 }
 
 type AttendanceStatus string
@@ -36,6 +39,7 @@ type attendanceTableRow struct {
 	PlayerID   string
 	PlayerName string
 	Status     []string
+	Links      []string
 }
 
 func parseAttendanceGametime(text string) (time.Time, error) {
@@ -98,11 +102,15 @@ func parseAttendanceBody(table *goquery.Selection) []attendanceTableRow {
 		playerId := u.Query().Get("person")
 
 		attendanceStatus := []string{}
+		attendanceLinks := []string{}
 
 		attendance := row.Find("td")
 		attendance = attendance.Slice(1, attendance.Length()-2)
 
 		attendance.Each(func(i int, s *goquery.Selection) {
+			link, _ := s.Find("a").Attr("href")
+			attendanceLinks = append(attendanceLinks, link)
+
 			status, ok := s.Find("img").Attr("title")
 
 			if !ok {
@@ -119,28 +127,15 @@ func parseAttendanceBody(table *goquery.Selection) []attendanceTableRow {
 			PlayerID:   playerId,
 			PlayerName: playerName,
 			Status:     attendanceStatus,
+			Links:      attendanceLinks,
 		})
 	}
 
 	return attendanceRows
 }
 
-func GetAttendancePage(teamID string, context playwright.BrowserContext) (*bytes.Buffer, error) {
-	page, err := context.NewPage()
-	if err != nil {
-		return nil, err
-	}
-
-	page.Goto(fmt.Sprintf("/zuluru/teams/attendance?team=%s", teamID))
-	defer page.Close()
-
-	content, err := page.Content()
-	if err != nil {
-		return nil, err
-	}
-
-	buf := bytes.NewBuffer([]byte(content))
-	return buf, nil
+func GetAttendancePage(ctx context.Context, teamID string, browserContext playwright.BrowserContext) (*bytes.Buffer, error) {
+	return getPageContent(ctx, fmt.Sprintf("/zuluru/teams/attendance?team=%s", teamID), browserContext)
 }
 
 func ParseAttendancePage(page io.Reader) ([]Attendance, error) {
@@ -151,6 +146,9 @@ func ParseAttendancePage(page io.Reader) ([]Attendance, error) {
 
 	// find the table element
 	table := doc.Find("div.teams.attendance").Find("table").First()
+	if table.Length() == 0 {
+		return nil, fmt.Errorf("%w: no attendance table", ErrUnexpectedPage)
+	}
 
 	headers := parseAttendanceHeaders(table)
 	rows := parseAttendanceBody(table)
@@ -161,15 +159,30 @@ func ParseAttendancePage(page io.Reader) ([]Attendance, error) {
 	for week, header := range headers {
 		// get each players status for the week
 		players := map[string]AttendanceStatus{}
+		links := map[string]string{}
 		for _, player := range rows {
 			players[player.PlayerID] = AttendanceStatus(player.Status[week])
+			if player.Links[week] != "" {
+				links[player.PlayerID] = player.Links[week]
+			}
 		}
 
 		weeks = append(weeks, Attendance{
-			Gametime: header.Gametime,
-			Players:  players,
+			Gametime:   header.Gametime,
+			Players:    players,
+			ChangeURLs: links,
 		})
 	}
 
 	return weeks, nil
 }
+
+// FindWeek returns the week with a game on the given date in "YYYY-mm-dd" format
+func FindWeek(weeks []Attendance, date string) (Attendance, bool) {
+	for _, week := range weeks {
+		if week.Gametime.Format("2006-01-02") == date {
+			return week, true
+		}
+	}
+	return Attendance{}, false
+}
@@ -40,3 +40,39 @@ func GetAttendanceReport(week Attendance, team map[string]Player) AttendanceRepo
 		Invited: invited,
 	}
 }
+
+// GenderThreshold is the minimum number of attending players on each gender line
+type GenderThreshold struct {
+	Open  int
+	Woman int
+}
+
+// Shortfall returns how many more players each gender line needs
+func (threshold GenderThreshold) Shortfall(report AttendanceReport) (int, int) {
+	return max(threshold.Open-len(report.Open), 0), max(threshold.Woman-len(report.Woman), 0)
+}
+
+// GetAvailableSubs returns the substitutes of the given gender ("O" or "W") that
+// haven't been invited and aren't attending the week
+func GetAvailableSubs(week Attendance, team map[string]Player, gender string) []Player {
+	subs := []Player{}
+
+	for playerID, player := range team {
+		if player.Role != "Substitute player" {
+			continue
+		}
+
+		if (gender == "W") != (player.Gender == "W") {
+			continue
+		}
+
+		status := week.Players[playerID]
+		if status == INVITED || status == ATTENDING {
+			continue
+		}
+
+		subs = append(subs, player)
+	}
+
+	return subs
+}
@@ -0,0 +1,54 @@
+package ocua
+
+import "testing"
+
+func TestGenderThresholdShortfall(t *testing.T) {
+	report := AttendanceReport{
+		Open:  []Player{{ID: "1"}, {ID: "2"}},
+		Woman: []Player{{ID: "3"}},
+	}
+
+	tests := []struct {
+		threshold   GenderThreshold
+		open, woman int
+	}{
+		{GenderThreshold{Open: 4, Woman: 3}, 2, 2},
+		{GenderThreshold{Open: 2, Woman: 3}, 0, 2},
+		{GenderThreshold{Open: 1}, 0, 0},
+	}
+
+	for _, test := range tests {
+		open, woman := test.threshold.Shortfall(report)
+		if open != test.open || woman != test.woman {
+			t.Errorf("%+v shortfall = %d, %d, want %d, %d", test.threshold, open, woman, test.open, test.woman)
+		}
+	}
+}
+
+func TestGetAvailableSubs(t *testing.T) {
+	team := map[string]Player{
+		"1": {ID: "1", Role: "Captain", Gender: "W"},
+		"2": {ID: "2", Role: "Substitute player", Gender: "W"},
+		"3": {ID: "3", Role: "Substitute player", Gender: "W"},
+		"4": {ID: "4", Role: "Substitute player", Gender: "W"},
+		"5": {ID: "5", Role: "Substitute player", Gender: "O"},
+	}
+
+	week := Attendance{Players: map[string]AttendanceStatus{
+		"1": UNKNOWN,
+		"2": INVITED,
+		"3": ATTENDING,
+		"4": ABSENT,
+		"5": UNKNOWN,
+	}}
+
+	subs := GetAvailableSubs(week, team, "W")
+	if len(subs) != 1 || subs[0].ID != "4" {
+		t.Errorf("W subs = %v, want only 4", subs)
+	}
+
+	subs = GetAvailableSubs(week, team, "O")
+	if len(subs) != 1 || subs[0].ID != "5" {
+		t.Errorf("O subs = %v, want only 5", subs)
+	}
+}
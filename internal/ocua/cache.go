@@ -0,0 +1,251 @@
+package ocua
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// API is the part of Client and HTTPClient wrapped by CachedClient
+type API interface {
+	GetTeam(ctx context.Context, teamID string) (map[string]Player, error)
+	GetAttendance(ctx context.Context, teamID string) ([]Attendance, error)
+	GetSchedule(ctx context.Context, teamID string) ([]Game, error)
+	SetAttendance(ctx context.Context, teamID, playerID, date string, status AttendanceStatus) error
+}
+
+// fetches started by the cache outlive the request that started them so other
+// requests waiting on the same page aren't cancelled with it. they're cancelled
+// when the cache is closed instead
+const cacheFetchTimeout = 2 * time.Minute
+
+// CachedClient caches team, attendance and schedule pages. concurrent requests for the
+// same page share one fetch, and pages older than the team's TTL are returned
+// while they're fetched again in the background, up to MaxStale. writes
+// invalidate the team's attendance
+type CachedClient struct {
+	API
+
+	TTL      time.Duration            // defaults to 1 minute
+	TeamTTL  map[string]time.Duration // optional map of team id -> ttl
+	MaxStale time.Duration            // defaults to 10 minutes, older pages are fetched before returning
+
+	Now    func() time.Time // defaults to time.Now
+	Logger *slog.Logger     // defaults to slog.Default
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+	fetches map[cacheKey]*cacheFetch
+	ctx     context.Context // parent of every fetch, cancelled by Close
+	cancel  context.CancelFunc
+}
+
+type cacheKey struct {
+	page   string // "team", "attendance" or "schedule"
+	teamID string
+}
+
+type cacheEntry struct {
+	value   any
+	fetched time.Time
+}
+
+// cacheFetch is an in-flight fetch shared by every request for the page
+type cacheFetch struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+func (cache *CachedClient) now() time.Time {
+	if cache.Now != nil {
+		return cache.Now()
+	}
+	return time.Now()
+}
+
+func (cache *CachedClient) logger() *slog.Logger {
+	if cache.Logger != nil {
+		return cache.Logger
+	}
+	return slog.Default()
+}
+
+// fetchContext returns the parent of every fetch. the caller must hold mu
+func (cache *CachedClient) fetchContext() context.Context {
+	if cache.ctx == nil {
+		cache.ctx, cache.cancel = context.WithCancel(context.Background())
+	}
+	return cache.ctx
+}
+
+// Close cancels the fetches in flight. requests for pages that aren't cached
+// fail once the cache is closed
+func (cache *CachedClient) Close() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.fetchContext()
+	cache.cancel()
+}
+
+func (cache *CachedClient) ttl(teamID string) time.Duration {
+	if ttl, ok := cache.TeamTTL[teamID]; ok {
+		return ttl
+	}
+	if cache.TTL != 0 {
+		return cache.TTL
+	}
+	return time.Minute
+}
+
+func (cache *CachedClient) maxStale() time.Duration {
+	if cache.MaxStale != 0 {
+		return cache.MaxStale
+	}
+	return time.Minute * 10
+}
+
+// fetch starts fetching the page unless a fetch is already in flight. the
+// caller must hold mu
+func (cache *CachedClient) fetch(key cacheKey, get func(context.Context) (any, error)) *cacheFetch {
+	if cache.fetches == nil {
+		cache.fetches = map[cacheKey]*cacheFetch{}
+	}
+
+	if f, ok := cache.fetches[key]; ok {
+		return f
+	}
+
+	f := &cacheFetch{done: make(chan struct{})}
+	cache.fetches[key] = f
+	parent := cache.fetchContext()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(parent, cacheFetchTimeout)
+		defer cancel()
+
+		f.value, f.err = get(ctx)
+
+		cache.mu.Lock()
+		// an invalidation while fetching replaces the fetch, the page it got
+		// might be from before the write
+		if cache.fetches[key] == f {
+			delete(cache.fetches, key)
+			if f.err == nil {
+				if cache.entries == nil {
+					cache.entries = map[cacheKey]*cacheEntry{}
+				}
+				cache.entries[key] = &cacheEntry{value: f.value, fetched: cache.now()}
+			}
+		}
+		cache.mu.Unlock()
+
+		close(f.done)
+	}()
+
+	return f
+}
+
+// get returns the cached page if it's fresh enough, otherwise waits for it to
+// be fetched or ctx to be cancelled
+func (cache *CachedClient) get(ctx context.Context, key cacheKey, get func(context.Context) (any, error)) (any, error) {
+	cache.mu.Lock()
+
+	entry, ok := cache.entries[key]
+	if ok {
+		age := cache.now().Sub(entry.fetched)
+		if age < cache.ttl(key.teamID) {
+			cache.mu.Unlock()
+			return entry.value, nil
+		}
+
+		// stale while revalidate
+		if age < cache.maxStale() {
+			f := cache.fetch(key, get)
+			cache.mu.Unlock()
+
+			go func() {
+				<-f.done
+				if f.err != nil {
+					cache.logger().Warn("failed to refresh cached page", "page", key.page, "team", key.teamID, "error", f.err)
+				}
+			}()
+			return entry.value, nil
+		}
+	}
+
+	f := cache.fetch(key, get)
+	cache.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Refresh makes the next request for each of the team's pages fetch it again.
+// requests join a fetch that's already in flight instead of starting another,
+// use Invalidate after writes when an in-flight fetch might be out of date
+func (cache *CachedClient) Refresh(teamID string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for _, page := range []string{"team", "attendance", "schedule"} {
+		delete(cache.entries, cacheKey{page, teamID})
+	}
+}
+
+// Invalidate forgets the team's cached team, attendance and schedule pages
+// and any fetches in flight
+func (cache *CachedClient) Invalidate(teamID string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for _, page := range []string{"team", "attendance", "schedule"} {
+		key := cacheKey{page, teamID}
+		delete(cache.entries, key)
+		delete(cache.fetches, key)
+	}
+}
+
+func (cache *CachedClient) GetTeam(ctx context.Context, teamID string) (map[string]Player, error) {
+	value, err := cache.get(ctx, cacheKey{"team", teamID}, func(ctx context.Context) (any, error) {
+		return cache.API.GetTeam(ctx, teamID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[string]Player), nil
+}
+
+func (cache *CachedClient) GetAttendance(ctx context.Context, teamID string) ([]Attendance, error) {
+	value, err := cache.get(ctx, cacheKey{"attendance", teamID}, func(ctx context.Context) (any, error) {
+		return cache.API.GetAttendance(ctx, teamID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]Attendance), nil
+}
+
+func (cache *CachedClient) GetSchedule(ctx context.Context, teamID string) ([]Game, error) {
+	value, err := cache.get(ctx, cacheKey{"schedule", teamID}, func(ctx context.Context) (any, error) {
+		return cache.API.GetSchedule(ctx, teamID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]Game), nil
+}
+
+// SetAttendance changes a player's attendance then invalidates the team's
+// cached pages. they're invalidated even if it fails since the change might
+// have been saved
+func (cache *CachedClient) SetAttendance(ctx context.Context, teamID, playerID, date string, status AttendanceStatus) error {
+	defer cache.Invalidate(teamID)
+	return cache.API.SetAttendance(ctx, teamID, playerID, date, status)
+}
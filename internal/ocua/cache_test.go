@@ -0,0 +1,250 @@
+package ocua_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// countingAPI counts fetches and blocks them until release is closed
+type countingAPI struct {
+	fetches atomic.Int32
+	release chan struct{}
+}
+
+func (api *countingAPI) GetTeam(ctx context.Context, teamID string) (map[string]ocua.Player, error) {
+	n := api.fetches.Add(1)
+	if api.release != nil {
+		select {
+		case <-api.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return map[string]ocua.Player{"1": {ID: "1", Name: string(rune('A' + n - 1))}}, nil
+}
+
+func (api *countingAPI) GetAttendance(ctx context.Context, teamID string) ([]ocua.Attendance, error) {
+	api.fetches.Add(1)
+	return []ocua.Attendance{}, nil
+}
+
+func (api *countingAPI) GetSchedule(ctx context.Context, teamID string) ([]ocua.Game, error) {
+	api.fetches.Add(1)
+	return []ocua.Game{}, nil
+}
+
+func (api *countingAPI) SetAttendance(ctx context.Context, teamID, playerID, date string, status ocua.AttendanceStatus) error {
+	return nil
+}
+
+// clock is a fake time that's safe to move while the cache reads it
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// teamName fetches the team and returns the player's name, "A" from the first
+// fetch, "B" from the second and so on
+func teamName(t *testing.T, cache *ocua.CachedClient) string {
+	t.Helper()
+	players, err := cache.GetTeam(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return players["1"].Name
+}
+
+func TestCacheCoalescesConcurrentFetches(t *testing.T) {
+	api := &countingAPI{release: make(chan struct{})}
+	cache := &ocua.CachedClient{API: api}
+
+	wg := sync.WaitGroup{}
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			teamName(t, cache)
+		}()
+	}
+
+	// let every request join the fetch before it finishes
+	time.Sleep(time.Millisecond * 50)
+	close(api.release)
+	wg.Wait()
+
+	if api.fetches.Load() != 1 {
+		t.Errorf("fetches = %d, want 1", api.fetches.Load())
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	api := &countingAPI{}
+	now := &clock{now: time.Now()}
+	cache := &ocua.CachedClient{
+		API:      api,
+		TTL:      time.Minute,
+		MaxStale: time.Minute * 10,
+		Now:      now.Now,
+	}
+
+	if name := teamName(t, cache); name != "A" {
+		t.Fatalf("name = %q, want A", name)
+	}
+
+	// fresh
+	now.Add(time.Second * 30)
+	if name := teamName(t, cache); name != "A" || api.fetches.Load() != 1 {
+		t.Fatalf("name = %q after %d fetches, want A after 1", name, api.fetches.Load())
+	}
+
+	// stale, returned while it's fetched again
+	now.Add(time.Minute)
+	if name := teamName(t, cache); name != "A" {
+		t.Fatalf("stale name = %q, want A", name)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for teamName(t, cache) != "B" {
+		if time.Now().After(deadline) {
+			t.Fatal("stale page wasn't refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// too stale to return, fetched before returning
+	now.Add(time.Hour)
+	if name := teamName(t, cache); name != "C" {
+		t.Fatalf("name = %q, want C", name)
+	}
+}
+
+func TestCacheTeamTTL(t *testing.T) {
+	api := &countingAPI{}
+	now := &clock{now: time.Now()}
+	cache := &ocua.CachedClient{
+		API:      api,
+		TTL:      time.Minute,
+		TeamTTL:  map[string]time.Duration{"2001": time.Hour},
+		MaxStale: time.Hour * 2,
+		Now:      now.Now,
+	}
+
+	teamName(t, cache)
+	now.Add(time.Minute * 30)
+	teamName(t, cache)
+
+	if api.fetches.Load() != 1 {
+		t.Errorf("fetches = %d, want 1", api.fetches.Load())
+	}
+}
+
+func TestCacheInvalidatedByWrites(t *testing.T) {
+	api := &countingAPI{}
+	cache := &ocua.CachedClient{API: api}
+
+	_, err := cache.GetAttendance(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cache.SetAttendance(context.Background(), "2001", "1", "2024-06-03", ocua.ATTENDING)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cache.GetAttendance(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if api.fetches.Load() != 2 {
+		t.Errorf("fetches = %d, want 2", api.fetches.Load())
+	}
+}
+
+func TestCacheRefreshJoinsInFlightFetch(t *testing.T) {
+	api := &countingAPI{release: make(chan struct{})}
+	cache := &ocua.CachedClient{API: api}
+
+	wg := sync.WaitGroup{}
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Refresh("2001")
+			teamName(t, cache)
+		}()
+	}
+
+	// let both refreshes join the fetch before it finishes
+	time.Sleep(time.Millisecond * 50)
+	close(api.release)
+	wg.Wait()
+
+	if api.fetches.Load() != 1 {
+		t.Fatalf("fetches = %d, want 1", api.fetches.Load())
+	}
+
+	// the cached page is skipped once the fetch is done
+	cache.Refresh("2001")
+	if name := teamName(t, cache); name != "B" {
+		t.Errorf("name = %q, want B", name)
+	}
+}
+
+func TestCacheCancelledWhileWaiting(t *testing.T) {
+	api := &countingAPI{release: make(chan struct{})}
+	defer close(api.release)
+	cache := &ocua.CachedClient{API: api}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	_, err := cache.GetTeam(ctx, "2001")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCacheCloseCancelsFetches(t *testing.T) {
+	api := &countingAPI{release: make(chan struct{})}
+	defer close(api.release)
+	cache := &ocua.CachedClient{API: api}
+
+	errs := make(chan error)
+	go func() {
+		_, err := cache.GetTeam(context.Background(), "2001")
+		errs <- err
+	}()
+
+	// let the fetch start before closing the cache
+	time.Sleep(time.Millisecond * 50)
+	cache.Close()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the fetch wasn't cancelled")
+	}
+}
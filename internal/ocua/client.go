@@ -1,8 +1,11 @@
 package ocua
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -19,13 +22,21 @@ func getSessionCookie(cookies []playwright.Cookie) (playwright.Cookie, bool) {
 	return playwright.Cookie{}, false
 }
 
+// sessions are refreshed this long before the session cookie expires
+const sessionRefreshMargin = 24 * time.Hour
+
+// getCookieExpires returns when the cookie expires. playwright uses -1 for
+// cookies without an expiry
 func getCookieExpires(cookie playwright.Cookie) time.Time {
-	expires := time.Unix(int64(cookie.Expires), 0)
-	return expires
+	if cookie.Expires <= 0 {
+		return time.Now().Add(defaultSessionLifetime)
+	}
+	return time.Unix(int64(cookie.Expires), 0)
 }
 
-// ClientSessionRefresher runs in the background and replaces main client cookies
-// before they expire. minimizes time where the main client is unusable.
+// ClientSessionRefresher runs in the background and swaps a freshly logged in
+// browser context into the main client before its session expires. the main
+// client keeps working with its old context while the new one logs in.
 type ClientSessionRefresher struct {
 	playwright.Browser
 	playwright.BrowserNewContextOptions
@@ -34,78 +45,178 @@ type ClientSessionRefresher struct {
 	Username string
 	Password string
 
+	Store *CookieStore // optional, reuses the session across restarts
+
+	StartupTimeout time.Duration // how long RunBackground waits for a session, defaults to 5 minutes
+	OnHealth       func(Health)  // optional, called after every background login
+
 	Logger *slog.Logger
+
+	loop *refreshLoop
 }
 
-func (refresher *ClientSessionRefresher) RunOnce() (time.Time, error) {
-	cookies, expires, err := refresher.getFreshCookies()
+// RunOnce logs in with a new browser context and swaps it into the client.
+// the client keeps its current context if anything fails. returns the
+// expiration time of the new session cookie
+func (refresher *ClientSessionRefresher) RunOnce(ctx context.Context) (time.Time, error) {
+	browserContext, cookies, expires, err := refresher.newSession(ctx)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	err = refresher.Client.setCookies(cookies)
-	if err != nil {
-		return time.Time{}, err
+	refresher.Client.swap(browserContext)
+
+	if refresher.Store != nil {
+		err = refresher.Store.Save(cookies)
+		if err != nil {
+			refresher.Logger.Error("failed to save cookies", "error", err)
+		}
 	}
 
 	return expires, nil
 }
 
-func (refresher *ClientSessionRefresher) RunBackground() {
-	once := sync.Once{}
-	wg := sync.WaitGroup{}
-	wg.Add(1)
+// restore swaps in a browser context with the saved session if it's valid for
+// at least another day and still works. returns the expiration time of the
+// saved session cookie
+func (refresher *ClientSessionRefresher) restore(ctx context.Context) (time.Time, bool) {
+	if refresher.Store == nil {
+		return time.Time{}, false
+	}
 
-	go func() {
-		for {
-			// refresh the session
-			cookies, expires, err := refresher.getFreshCookies()
-			if err != nil {
-				refresher.Logger.Error("failed to refresh cookies", "error", err)
-				time.Sleep(time.Minute * 30)
-				continue
-			}
-
-			// refresh the client with new cookies
-			err = refresher.Client.setCookies(cookies)
-			if err != nil {
-				refresher.Logger.Error("failed to refresh client cookies", "error", err)
-				time.Sleep(time.Minute * 30)
-				continue
-			}
-
-			// successfully refreshed cookies
-			refresher.Logger.Info("successfully refreshed cookies")
-
-			once.Do(func() {
-				wg.Done()
-			})
-
-			// sleep until the next refresh
-			d := time.Until(expires.Add(-24 * time.Hour))
-			time.Sleep(d)
+	cookies := []playwright.Cookie{}
+	err := refresher.Store.Load(&cookies)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			refresher.Logger.Warn("failed to load saved cookies", "error", err)
 		}
-	}()
+		return time.Time{}, false
+	}
+
+	cookie, ok := getSessionCookie(cookies)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	expires := getCookieExpires(cookie)
+	if time.Until(expires) < sessionRefreshMargin {
+		return time.Time{}, false
+	}
+
+	browserContext, err := refresher.NewContext(refresher.BrowserNewContextOptions)
+	if err != nil {
+		refresher.Logger.Warn("failed to restore saved cookies", "error", err)
+		return time.Time{}, false
+	}
+
+	err = restoreSession(ctx, browserContext, cookies)
+	if err != nil {
+		browserContext.Close()
+		refresher.Logger.Warn("failed to restore saved cookies", "error", err)
+		return time.Time{}, false
+	}
+
+	refresher.Client.swap(browserContext)
+
+	refresher.Logger.Info("restored saved session", "expires", expires)
+	return expires, true
+}
+
+func restoreSession(ctx context.Context, browserContext playwright.BrowserContext, cookies []playwright.Cookie) error {
+	optional := make([]playwright.OptionalCookie, len(cookies))
+	for i, cookie := range cookies {
+		optional[i] = cookie.ToOptionalCookie()
+	}
+
+	err := browserContext.AddCookies(optional)
+	if err != nil {
+		return err
+	}
+
+	return verifySession(ctx, browserContext)
+}
+
+// verifySession checks that the browser context is logged in by loading the
+// account page, which redirects to or shows the login form without a session
+func verifySession(ctx context.Context, browserContext playwright.BrowserContext) error {
+	page, err := getPageContent(ctx, "/user", browserContext)
+	if err != nil {
+		return err
+	}
+	return checkLoggedIn("/user", page)
+}
+
+// attach lets the client log in with the refresher's loop when it finds the
+// session expired
+func (refresher *ClientSessionRefresher) attach(loop *refreshLoop) {
+	refresher.Client.mu.Lock()
+	defer refresher.Client.mu.Unlock()
+
+	refresher.Client.login = func(ctx context.Context) error {
+		refresher.Logger.Warn("session expired, refreshing cookies")
+		return loop.loginNow(ctx)
+	}
+}
+
+// RunBackground keeps the session fresh by logging in again a day before the
+// session cookie expires until ctx is cancelled. blocks until the client has a
+// session, returns an error if it doesn't have one within StartupTimeout or ctx
+// is cancelled first
+func (refresher *ClientSessionRefresher) RunBackground(ctx context.Context) error {
+	refresher.loop = &refreshLoop{
+		login:          refresher.RunOnce,
+		restore:        refresher.restore,
+		startupTimeout: refresher.StartupTimeout,
+		onHealth:       refresher.OnHealth,
+		logger:         refresher.Logger,
+	}
 
-	wg.Wait()
+	refresher.attach(refresher.loop)
+	return refresher.loop.run(ctx)
 }
 
-func (refresher *ClientSessionRefresher) getFreshCookies() ([]playwright.Cookie, time.Time, error) {
+// Health returns the state of the session
+func (refresher *ClientSessionRefresher) Health() Health {
+	if refresher.loop == nil {
+		return Health{}
+	}
+	return refresher.loop.snapshot()
+}
+
+// newSession logs in with a new browser context and checks that it works. the
+// caller owns the returned context
+func (refresher *ClientSessionRefresher) newSession(ctx context.Context) (playwright.BrowserContext, []playwright.Cookie, time.Time, error) {
 	// launch a new browser context with no cookies
-	context, err := refresher.NewContext(refresher.BrowserNewContextOptions)
+	browserContext, err := refresher.NewContext(refresher.BrowserNewContextOptions)
 	if err != nil {
-		return nil, time.Time{}, err
+		return nil, nil, time.Time{}, err
+	}
+
+	cookies, expires, err := login(ctx, refresher.Username, refresher.Password, browserContext)
+	if err != nil {
+		browserContext.Close()
+		return nil, nil, time.Time{}, err
 	}
-	defer context.Close()
 
+	return browserContext, cookies, expires, nil
+}
+
+// login logs in with the browser context, checks the session works and returns
+// its cookies and the expiration time of the session cookie
+func login(ctx context.Context, username, password string, browserContext playwright.BrowserContext) ([]playwright.Cookie, time.Time, error) {
 	// login to OCUA this would result in cookies saved to the browser
-	err = Login(refresher.Username, refresher.Password, context)
+	err := Login(ctx, username, password, browserContext)
 	if err != nil {
 		return nil, time.Time{}, err
 	}
 
+	err = verifySession(ctx, browserContext)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("logged in but the session doesn't work: %w", err)
+	}
+
 	// get cookies
-	cookies, err := context.Cookies()
+	cookies, err := browserContext.Cookies()
 	if err != nil {
 		return nil, time.Time{}, err
 	}
@@ -113,70 +224,154 @@ func (refresher *ClientSessionRefresher) getFreshCookies() ([]playwright.Cookie,
 	// get the session cookie
 	cookie, ok := getSessionCookie(cookies)
 	if !ok {
-		return nil, time.Time{}, errors.New("could not find session cookie")
+		return nil, time.Time{}, fmt.Errorf("%w: could not find session cookie", ErrUnexpectedPage)
 	}
 
 	// get the expiration time of the cookie
-	expires := getCookieExpires(cookie)
+	return cookies, getCookieExpires(cookie), nil
+}
 
-	return cookies, expires, err
+// browserSession is a logged in browser context and the requests using it
+type browserSession struct {
+	context  playwright.BrowserContext
+	requests sync.WaitGroup
 }
 
+// Client gets pages with a logged in browser context swapped in by a
+// ClientSessionRefresher. the zero value is ready to use once the refresher
+// has logged in
 type Client struct {
-	sync.RWMutex
-	playwright.BrowserContext
+	mu      sync.Mutex
+	current *browserSession
+	login   func(context.Context) error // set by the refresher to log in when a request finds the session expired
+
+	session sessionGuard
 }
 
-func (client *Client) setCookies(cookies []playwright.Cookie) error {
-	// convert cookies to optional
-	optional := make([]playwright.OptionalCookie, len(cookies))
-	for i, cookie := range cookies {
-		optional[i] = cookie.ToOptionalCookie()
+// acquire returns the current browser session. the caller must call
+// requests.Done when its request finishes
+func (client *Client) acquire() (*browserSession, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.current == nil {
+		return nil, errors.New("not logged in")
 	}
 
-	// acquire write lock
-	client.Lock()
-	defer client.Unlock()
+	client.current.requests.Add(1)
+	return client.current, nil
+}
 
-	// reset cookies
-	err := client.ClearCookies(playwright.BrowserContextClearCookiesOptions{})
-	if err != nil {
-		return err
+// swap makes browserContext the client's context. requests already using the
+// old context finish on it, then it's closed
+func (client *Client) swap(browserContext playwright.BrowserContext) {
+	client.mu.Lock()
+	old := client.current
+	client.current = &browserSession{context: browserContext}
+	client.mu.Unlock()
+
+	if old == nil {
+		return
 	}
 
-	return client.AddCookies(optional)
+	go func() {
+		old.requests.Wait()
+		old.context.Close()
+	}()
 }
 
-func (client *Client) GetTeam(teamID string) (map[string]Player, error) {
-	client.RLock()
-	defer client.RUnlock()
+// Close closes the current browser context
+func (client *Client) Close() error {
+	client.mu.Lock()
+	current := client.current
+	client.current = nil
+	client.mu.Unlock()
 
-	page, err := GetTeamPage(teamID, client.BrowserContext)
-	if err != nil {
-		return nil, err
+	if current == nil {
+		return nil
 	}
+	return current.context.Close()
+}
 
-	attendance, err := ParseTeamPage(page)
-	if err != nil {
-		return nil, err
-	}
+// withSession runs request with the current browser context. if the session
+// expired it logs in again with the refresher and runs request once more with
+// the new context
+func (client *Client) withSession(ctx context.Context, request func(playwright.BrowserContext) error) error {
+	client.mu.Lock()
+	login := client.login
+	client.mu.Unlock()
+
+	return client.session.retry(ctx, login, func() error {
+		session, err := client.acquire()
+		if err != nil {
+			return err
+		}
+		defer session.requests.Done()
 
-	return attendance, nil
+		return request(session.context)
+	})
 }
 
-func (client *Client) GetAttendance(teamID string) ([]Attendance, error) {
-	client.RLock()
-	defer client.RUnlock()
+func (client *Client) GetTeam(ctx context.Context, teamID string) (map[string]Player, error) {
+	var players map[string]Player
+	err := client.withSession(ctx, func(browserContext playwright.BrowserContext) error {
+		page, err := GetTeamPage(ctx, teamID, browserContext)
+		if err != nil {
+			return err
+		}
 
-	page, err := GetAttendancePage(teamID, client.BrowserContext)
-	if err != nil {
-		return nil, err
-	}
+		players, err = ParseTeamPage(page)
+		return err
+	})
+	return players, err
+}
 
-	attendance, err := ParseAttendancePage(page)
-	if err != nil {
-		return nil, err
-	}
+func (client *Client) GetAttendance(ctx context.Context, teamID string) ([]Attendance, error) {
+	var attendance []Attendance
+	err := client.withSession(ctx, func(browserContext playwright.BrowserContext) error {
+		page, err := GetAttendancePage(ctx, teamID, browserContext)
+		if err != nil {
+			return err
+		}
+
+		attendance, err = ParseAttendancePage(page)
+		return err
+	})
+	return attendance, err
+}
+
+func (client *Client) GetSchedule(ctx context.Context, teamID string) ([]Game, error) {
+	var games []Game
+	err := client.withSession(ctx, func(browserContext playwright.BrowserContext) error {
+		page, err := GetSchedulePage(ctx, teamID, browserContext)
+		if err != nil {
+			return err
+		}
+
+		games, err = ParseSchedulePage(page)
+		return err
+	})
+	return games, err
+}
+
+// SetAttendance changes a player's attendance for the game on date ("YYYY-mm-dd")
+func (client *Client) SetAttendance(ctx context.Context, teamID, playerID, date string, status AttendanceStatus) error {
+	return client.withSession(ctx, func(browserContext playwright.BrowserContext) error {
+		page, err := GetAttendancePage(ctx, teamID, browserContext)
+		if err != nil {
+			return err
+		}
+
+		weeks, err := ParseAttendancePage(page)
+		if err != nil {
+			return err
+		}
+
+		changeURL, err := getAttendanceChangeURL(weeks, playerID, date)
+		if err != nil {
+			return err
+		}
 
-	return attendance, nil
+		return ChangeAttendance(ctx, changeURL, status, browserContext)
+	})
 }
@@ -0,0 +1,160 @@
+package ocua_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua/ocuatest"
+	"github.com/playwright-community/playwright-go"
+)
+
+// launchBrowser starts a headless browser for the test. the test is skipped
+// when playwright or its browsers aren't installed, run cmd/pwinstall first
+func launchBrowser(t *testing.T) playwright.Browser {
+	t.Helper()
+
+	pw, err := playwright.Run()
+	if err != nil {
+		t.Skipf("playwright isn't installed: %s", err)
+	}
+	t.Cleanup(func() { pw.Stop() })
+
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{})
+	if err != nil {
+		t.Skipf("failed to launch chromium: %s", err)
+	}
+	t.Cleanup(func() { browser.Close() })
+
+	return browser
+}
+
+func newTestRefresher(t *testing.T, server *ocuatest.Server, client *ocua.Client) *ocua.ClientSessionRefresher {
+	return &ocua.ClientSessionRefresher{
+		Browser: launchBrowser(t),
+		BrowserNewContextOptions: playwright.BrowserNewContextOptions{
+			BaseURL: playwright.String(server.URL),
+		},
+		Client:   client,
+		Username: "captain@example.com",
+		Password: "hunter2",
+		Logger:   slog.Default(),
+	}
+}
+
+func TestClientSessionRefresher(t *testing.T) {
+	server, team := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &ocua.Client{}
+	defer client.Close()
+
+	refresher := newTestRefresher(t, server, client)
+	if err := refresher.RunBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if health := refresher.Health(); !health.Healthy(time.Now()) {
+		t.Errorf("health = %+v, want a successful login", health)
+	}
+
+	players, err := client.GetTeam(ctx, "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(players) != len(team.Players) {
+		t.Errorf("got %d players, want %d", len(players), len(team.Players))
+	}
+
+	date := team.Weeks[len(team.Weeks)-1].Gametime.Format("2006-01-02")
+	err = client.SetAttendance(ctx, "2001", "1002", date, ocua.ABSENT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := server.Status("2001", "1002", date); status != ocua.ABSENT {
+		t.Errorf("status = %s, want %s", status, ocua.ABSENT)
+	}
+
+	// requests that find the session expired log in again
+	server.ExpireSessions()
+
+	_, err = client.GetAttendance(ctx, "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Logins() != 2 {
+		t.Errorf("logins = %d, want 2", server.Logins())
+	}
+}
+
+func TestClientSessionRefresherRestoresSavedSession(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	store := &ocua.CookieStore{
+		Path: filepath.Join(t.TempDir(), "session.enc"),
+		Key:  bytes.Repeat([]byte{1}, 32),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &ocua.Client{}
+	defer client.Close()
+
+	refresher := newTestRefresher(t, server, client)
+	refresher.Store = store
+	if err := refresher.RunBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted bot reuses the saved session instead of logging in
+	restarted := &ocua.Client{}
+	defer restarted.Close()
+
+	restartedRefresher := newTestRefresher(t, server, restarted)
+	restartedRefresher.Store = store
+	if err := restartedRefresher.RunBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := restarted.GetTeam(ctx, "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Logins() != 1 {
+		t.Errorf("logins = %d, want 1", server.Logins())
+	}
+}
+
+func TestClientSessionRefresherWrongPassword(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &ocua.Client{}
+	defer client.Close()
+
+	refresher := newTestRefresher(t, server, client)
+	refresher.Password = "wrong"
+	refresher.StartupTimeout = time.Millisecond * 200
+
+	err := refresher.RunBackground(ctx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if health := refresher.Health(); health.LastError == nil {
+		t.Errorf("health = %+v, want the failed login", health)
+	}
+}
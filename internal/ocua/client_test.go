@@ -0,0 +1,103 @@
+package ocua
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// fakeBrowserContext records when it's closed, other methods aren't implemented
+type fakeBrowserContext struct {
+	playwright.BrowserContext
+	closed atomic.Bool
+}
+
+func (browserContext *fakeBrowserContext) Close(options ...playwright.BrowserContextCloseOptions) error {
+	browserContext.closed.Store(true)
+	return nil
+}
+
+func TestClientSwapWaitsForRequests(t *testing.T) {
+	client := &Client{}
+	first := &fakeBrowserContext{}
+	second := &fakeBrowserContext{}
+
+	err := client.withSession(context.Background(), func(playwright.BrowserContext) error { return nil })
+	if err == nil {
+		t.Fatal("expected an error before logging in")
+	}
+
+	client.swap(first)
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan playwright.BrowserContext)
+
+	// a request in flight on the first context
+	go func() {
+		client.withSession(context.Background(), func(browserContext playwright.BrowserContext) error {
+			close(started)
+			<-finish
+			done <- browserContext
+			return nil
+		})
+	}()
+	<-started
+
+	client.swap(second)
+
+	// new requests use the new context
+	client.withSession(context.Background(), func(browserContext playwright.BrowserContext) error {
+		if browserContext != second {
+			t.Error("expected the new context")
+		}
+		return nil
+	})
+
+	if first.closed.Load() {
+		t.Fatal("closed the old context while a request was using it")
+	}
+
+	close(finish)
+	if <-done != first {
+		t.Error("expected the in-flight request to finish on the old context")
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !first.closed.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("the old context wasn't closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if second.closed.Load() {
+		t.Error("closed the current context")
+	}
+}
+
+func TestClientKeepsContextWhenLoginFails(t *testing.T) {
+	current := &fakeBrowserContext{}
+	client := &Client{}
+	client.swap(current)
+
+	loginErr := errors.New("login failed")
+	client.login = func(ctx context.Context) error { return loginErr }
+
+	var used playwright.BrowserContext
+	err := client.withSession(context.Background(), func(browserContext playwright.BrowserContext) error {
+		used = browserContext
+		return ErrSessionExpired
+	})
+
+	if !errors.Is(err, loginErr) {
+		t.Errorf("err = %v, want the login error", err)
+	}
+	if used != current || current.closed.Load() {
+		t.Error("expected the client to keep its context")
+	}
+}
@@ -0,0 +1,77 @@
+package ocua
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/fileutil"
+)
+
+// CookieStore saves session cookies to Path encrypted with AES-GCM so a restart
+// can reuse the session instead of logging in again. Key must be 16, 24 or 32 bytes
+type CookieStore struct {
+	Path string
+	Key  []byte
+}
+
+func (store *CookieStore) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(store.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Save encrypts cookies as json and writes them to Path
+func (store *CookieStore) Save(cookies any) error {
+	data, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := store.gcm()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	// the nonce is stored in front of the ciphertext
+	sealed := gcm.Seal(nonce, nonce, data, nil)
+
+	return fileutil.WriteFileAtomic(store.Path, sealed, 0o600)
+}
+
+// Load decrypts the cookies saved at Path into cookies. returns an error
+// wrapping os.ErrNotExist if nothing has been saved
+func (store *CookieStore) Load(cookies any) error {
+	sealed, err := os.ReadFile(store.Path)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := store.gcm()
+	if err != nil {
+		return err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return errors.New("saved cookies are truncated")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return errors.New("failed to decrypt saved cookies, the key may have changed")
+	}
+
+	return json.Unmarshal(data, cookies)
+}
@@ -0,0 +1,467 @@
+package ocua
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// HTTPClient fetches OCUA pages with net/http instead of a playwright browser.
+// it's much lighter than Client but relies on OCUA pages working without javascript
+type HTTPClient struct {
+	BaseURL  string
+	Username string
+	Password string
+
+	Store *CookieStore // optional, reuses the session across restarts
+
+	StartupTimeout time.Duration // how long RunBackground waits for a session, defaults to 5 minutes
+	OnHealth       func(Health)  // optional, called after every background login
+
+	Logger *slog.Logger
+
+	loop   *refreshLoop
+	mu     sync.RWMutex
+	client *http.Client
+
+	session sessionGuard
+}
+
+func getHTTPSessionCookie(cookies []*http.Cookie) (*http.Cookie, bool) {
+	for _, cookie := range cookies {
+		if strings.HasPrefix(cookie.Name, "SSESS") {
+			return cookie, true
+		}
+	}
+	return nil, false
+}
+
+// getHTTPCookieExpires returns when the cookie expires, Max-Age takes
+// precedence over Expires like it does in browsers
+func getHTTPCookieExpires(cookie *http.Cookie) time.Time {
+	switch {
+	case cookie.MaxAge > 0:
+		return time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+	case !cookie.Expires.IsZero():
+		return cookie.Expires
+	}
+	return time.Now().Add(defaultSessionLifetime)
+}
+
+// parseForm returns the form action and the hidden fields drupal expects to be
+// posted back with the form (form_build_id, form_id, form_token)
+func parseForm(form *goquery.Selection) (string, url.Values) {
+	action, _ := form.Attr("action")
+
+	fields := url.Values{}
+	form.Find("input[type=hidden]").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		value, _ := s.Attr("value")
+		fields.Set(name, value)
+	})
+
+	return action, fields
+}
+
+func findForm(page io.Reader, selector string) (string, url.Values, error) {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return "", nil, err
+	}
+
+	form := doc.Find(selector).First().Closest("form")
+	if form.Length() == 0 {
+		return "", nil, fmt.Errorf("could not find form containing %q", selector)
+	}
+
+	action, fields := parseForm(form)
+	return action, fields, nil
+}
+
+func (client *HTTPClient) resolve(path string) (string, error) {
+	base, err := url.Parse(client.BaseURL)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (client *HTTPClient) get(ctx context.Context, c *http.Client, path string) (*bytes.Buffer, error) {
+	u, err := client.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	err = checkResponse(path, res.StatusCode, res.Request.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// Login creates a fresh cookie jar, logs in to OCUA and swaps the new session
+// in once the login succeeds. returns the expiration time of the session cookie
+func (client *HTTPClient) Login(ctx context.Context) (time.Time, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	c := &http.Client{Jar: jar, Timeout: time.Minute}
+
+	// get the login form
+	page, err := client.get(ctx, c, "/user/login")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	action, fields, err := findForm(page, "#edit-name")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if action == "" {
+		action = "/user/login"
+	}
+
+	u, err := client.resolve(action)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	fields.Set("name", client.Username)
+	fields.Set("pass", client.Password)
+	fields.Set("op", "Log in")
+
+	// submit the form without following the redirect so the session cookie is
+	// read from the response that sets it
+	login := &http.Client{
+		Jar:     jar,
+		Timeout: time.Minute,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := postForm(ctx, login, u, fields)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return time.Time{}, fmt.Errorf("%w: status code %d", ErrRateLimited, res.StatusCode)
+	}
+
+	cookies := res.Cookies()
+	cookie, ok := getHTTPSessionCookie(cookies)
+	if !ok {
+		// drupal re-renders the form with an error message when the login fails
+		err = checkLoginResult(res.Body)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Time{}, fmt.Errorf("%w: could not find session cookie", ErrUnexpectedPage)
+	}
+
+	client.mu.Lock()
+	client.client = c
+	client.mu.Unlock()
+
+	// save the expiry as a time so a relative Max-Age isn't extended on restore
+	expires := getHTTPCookieExpires(cookie)
+	cookie.Expires, cookie.MaxAge = expires, 0
+
+	if client.Store != nil {
+		err = client.Store.Save(cookies)
+		if err != nil {
+			client.Logger.Error("failed to save cookies", "error", err)
+		}
+	}
+
+	return expires, nil
+}
+
+// restore swaps in the saved session if it's valid for at least another day
+// and OCUA still accepts it. returns the expiration time of the saved session
+// cookie
+func (client *HTTPClient) restore(ctx context.Context) (time.Time, bool) {
+	if client.Store == nil {
+		return time.Time{}, false
+	}
+
+	cookies := []*http.Cookie{}
+	err := client.Store.Load(&cookies)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			client.Logger.Warn("failed to load saved cookies", "error", err)
+		}
+		return time.Time{}, false
+	}
+
+	cookie, ok := getHTTPSessionCookie(cookies)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	expires := getHTTPCookieExpires(cookie)
+	if time.Until(expires) < sessionRefreshMargin {
+		return time.Time{}, false
+	}
+
+	base, err := url.Parse(client.BaseURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return time.Time{}, false
+	}
+	jar.SetCookies(base, cookies)
+
+	// the account page redirects to or shows the login form without a session
+	c := &http.Client{Jar: jar, Timeout: time.Minute}
+	page, err := client.get(ctx, c, "/user")
+	if err == nil {
+		err = checkLoggedIn("/user", page)
+	}
+	if err != nil {
+		client.Logger.Warn("failed to restore saved cookies", "error", err)
+		return time.Time{}, false
+	}
+
+	client.mu.Lock()
+	client.client = c
+	client.mu.Unlock()
+
+	client.Logger.Info("restored saved session", "expires", expires)
+	return expires, true
+}
+
+// RunBackground logs in and keeps the session fresh by logging in again a day
+// before the session cookie expires until ctx is cancelled. blocks until the
+// client has a session, returns an error if it doesn't have one within
+// StartupTimeout or ctx is cancelled first
+func (client *HTTPClient) RunBackground(ctx context.Context) error {
+	client.loop = &refreshLoop{
+		login:          client.Login,
+		restore:        client.restore,
+		startupTimeout: client.StartupTimeout,
+		onHealth:       client.OnHealth,
+		logger:         client.Logger,
+	}
+
+	return client.loop.run(ctx)
+}
+
+// Health returns the state of the session
+func (client *HTTPClient) Health() Health {
+	if client.loop == nil {
+		return Health{}
+	}
+	return client.loop.snapshot()
+}
+
+// current returns the http client with the current session
+func (client *HTTPClient) current() (*http.Client, error) {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	if client.client == nil {
+		return nil, errors.New("not logged in")
+	}
+	return client.client, nil
+}
+
+func (client *HTTPClient) getPage(ctx context.Context, path string) (*bytes.Buffer, error) {
+	c, err := client.current()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.get(ctx, c, path)
+}
+
+func (client *HTTPClient) GetTeam(ctx context.Context, teamID string) (map[string]Player, error) {
+	var players map[string]Player
+	err := client.session.retry(ctx, client.login, func() error {
+		page, err := client.getPage(ctx, fmt.Sprintf("/zuluru/teams/view?team=%s", teamID))
+		if err != nil {
+			return err
+		}
+
+		players, err = ParseTeamPage(page)
+		return err
+	})
+	return players, err
+}
+
+func (client *HTTPClient) GetAttendance(ctx context.Context, teamID string) ([]Attendance, error) {
+	var attendance []Attendance
+	err := client.session.retry(ctx, client.login, func() error {
+		var err error
+		attendance, err = client.getAttendance(ctx, teamID)
+		return err
+	})
+	return attendance, err
+}
+
+func (client *HTTPClient) getAttendance(ctx context.Context, teamID string) ([]Attendance, error) {
+	page, err := client.getPage(ctx, fmt.Sprintf("/zuluru/teams/attendance?team=%s", teamID))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseAttendancePage(page)
+}
+
+func (client *HTTPClient) GetSchedule(ctx context.Context, teamID string) ([]Game, error) {
+	var games []Game
+	err := client.session.retry(ctx, client.login, func() error {
+		page, err := client.getPage(ctx, fmt.Sprintf("/zuluru/teams/schedule?team=%s", teamID))
+		if err != nil {
+			return err
+		}
+
+		games, err = ParseSchedulePage(page)
+		return err
+	})
+	return games, err
+}
+
+// SetAttendance changes a player's attendance for the game on date ("YYYY-mm-dd")
+func (client *HTTPClient) SetAttendance(ctx context.Context, teamID, playerID, date string, status AttendanceStatus) error {
+	return client.session.retry(ctx, client.login, func() error {
+		return client.setAttendance(ctx, teamID, playerID, date, status)
+	})
+}
+
+func (client *HTTPClient) setAttendance(ctx context.Context, teamID, playerID, date string, status AttendanceStatus) error {
+	code, err := getAttendanceStatusCode(status)
+	if err != nil {
+		return err
+	}
+
+	weeks, err := client.getAttendance(ctx, teamID)
+	if err != nil {
+		return err
+	}
+
+	changeURL, err := getAttendanceChangeURL(weeks, playerID, date)
+	if err != nil {
+		return err
+	}
+
+	page, err := client.getPage(ctx, changeURL)
+	if err != nil {
+		return err
+	}
+
+	action, fields, err := findForm(page, "input[name=status]")
+	if err != nil {
+		return err
+	}
+
+	if action == "" {
+		action = changeURL
+	}
+
+	fields.Set("status", code)
+	result, err := client.submitForm(ctx, action, fields)
+	if err != nil {
+		return err
+	}
+
+	return checkAttendanceChangeResult(result)
+}
+
+func postForm(ctx context.Context, c *http.Client, u string, fields url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(fields.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.Do(req)
+}
+
+// submitForm posts the form and returns the page it redirects to
+func (client *HTTPClient) submitForm(ctx context.Context, path string, fields url.Values) (*bytes.Buffer, error) {
+	c, err := client.current()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := client.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := postForm(ctx, c, u, fields)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	err = checkResponse(path, res.StatusCode, res.Request.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(res.Body)
+	return buf, err
+}
+
+// login is used to refresh the session when a request finds it expired. it
+// goes through the background loop when it's running so failures are recorded
+// in the health
+func (client *HTTPClient) login(ctx context.Context) error {
+	client.Logger.Warn("session expired, logging in again")
+	if client.loop != nil {
+		return client.loop.loginNow(ctx)
+	}
+
+	_, err := client.Login(ctx)
+	return err
+}
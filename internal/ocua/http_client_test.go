@@ -0,0 +1,490 @@
+package ocua_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua/ocuatest"
+)
+
+func newTestServer(t *testing.T) (*ocuatest.Server, *ocuatest.Team) {
+	t.Helper()
+
+	server := ocuatest.NewServer("captain@example.com", "hunter2")
+	t.Cleanup(server.Close)
+
+	team := ocuatest.SampleTeam(time.Now())
+	server.SetTeam("2001", team)
+
+	return server, team
+}
+
+func newTestClient(server *ocuatest.Server, password string) *ocua.HTTPClient {
+	return &ocua.HTTPClient{
+		BaseURL:  server.URL,
+		Username: "captain@example.com",
+		Password: password,
+		Logger:   slog.Default(),
+	}
+}
+
+func TestHTTPClientLogin(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.SessionTTL = time.Hour
+
+	client := newTestClient(server, "hunter2")
+
+	expires, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := time.Until(expires); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("session expires in %s, want about 1h", d)
+	}
+
+	if server.Logins() != 1 {
+		t.Errorf("server saw %d logins, want 1", server.Logins())
+	}
+}
+
+func TestHTTPClientLoginBadPassword(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	client := newTestClient(server, "wrong")
+
+	_, err := client.Login(context.Background())
+	if !errors.Is(err, ocua.ErrBadCredentials) {
+		t.Fatalf("expected ErrBadCredentials, got %v", err)
+	}
+
+	_, err = client.GetTeam(context.Background(), "2001")
+	if err == nil {
+		t.Fatal("expected requests without a session to fail")
+	}
+}
+
+func TestHTTPClientLoginRateLimited(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.MaxFailed = 2
+
+	for range 2 {
+		_, err := newTestClient(server, "wrong").Login(context.Background())
+		if !errors.Is(err, ocua.ErrBadCredentials) {
+			t.Fatalf("expected ErrBadCredentials, got %v", err)
+		}
+	}
+
+	// the account is blocked even with the right password
+	_, err := newTestClient(server, "hunter2").Login(context.Background())
+	if !errors.Is(err, ocua.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestHTTPClientGetTeamAttendance(t *testing.T) {
+	server, team := newTestServer(t)
+
+	client := newTestClient(server, "hunter2")
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	players, err := client.GetTeam(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(players) != len(team.Players) {
+		t.Fatalf("got %d players, want %d", len(players), len(team.Players))
+	}
+
+	for _, want := range team.Players {
+		if got := players[want.ID]; got != want {
+			t.Errorf("player %s = %+v, want %+v", want.ID, got, want)
+		}
+	}
+
+	weeks, err := client.GetAttendance(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(weeks) != len(team.Weeks) {
+		t.Fatalf("got %d weeks, want %d", len(weeks), len(team.Weeks))
+	}
+
+	for i, week := range weeks {
+		if !week.Gametime.Equal(team.Weeks[i].Gametime) {
+			t.Errorf("week %d gametime = %s, want %s", i, week.Gametime, team.Weeks[i].Gametime)
+		}
+
+		for playerID, want := range team.Weeks[i].Players {
+			if got := week.Players[playerID]; got != want {
+				t.Errorf("week %d player %s = %s, want %s", i, playerID, got, want)
+			}
+		}
+	}
+}
+
+func TestHTTPClientGetSchedule(t *testing.T) {
+	server, team := newTestServer(t)
+
+	client := newTestClient(server, "hunter2")
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	games, err := client.GetSchedule(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(games) != len(team.Weeks) {
+		t.Fatalf("got %d games, want %d", len(games), len(team.Weeks))
+	}
+
+	for i, got := range games {
+		want := *team.Weeks[i].Game
+		if !got.Start.Equal(want.Start) || !got.End.Equal(want.End) {
+			t.Errorf("game %d time slot = %s-%s, want %s-%s", i, got.Start, got.End, want.Start, want.End)
+		}
+
+		got.Start, got.End = want.Start, want.End
+		if got != want {
+			t.Errorf("game %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestHTTPClientSetAttendance(t *testing.T) {
+	server, team := newTestServer(t)
+
+	client := newTestClient(server, "hunter2")
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := team.Weeks[2].Gametime.Format("2006-01-02")
+
+	err = client.SetAttendance(context.Background(), "2001", "1003", date, ocua.ATTENDING)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := server.Status("2001", "1003", date); status != ocua.ATTENDING {
+		t.Errorf("status = %s, want %s", status, ocua.ATTENDING)
+	}
+}
+
+func TestHTTPClientSetAttendanceRejected(t *testing.T) {
+	server, team := newTestServer(t)
+	team.Weeks[2].Locked = true
+
+	client := newTestClient(server, "hunter2")
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := team.Weeks[2].Gametime.Format("2006-01-02")
+
+	err = client.SetAttendance(context.Background(), "2001", "1003", date, ocua.ATTENDING)
+	if !errors.Is(err, ocua.ErrUnexpectedPage) {
+		t.Errorf("err = %v, want ErrUnexpectedPage", err)
+	}
+
+	if status := server.Status("2001", "1003", date); status != ocua.UNKNOWN {
+		t.Errorf("status = %s, want %s", status, ocua.UNKNOWN)
+	}
+}
+
+func TestHTTPClientErrorPage(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	client := newTestClient(server, "hunter2")
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetError("/zuluru/teams/view", http.StatusInternalServerError)
+
+	_, err = client.GetTeam(context.Background(), "2001")
+
+	var statusErr *ocua.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected a StatusError, got %v", err)
+	}
+
+	// server errors aren't fixed by logging in again
+	if server.Logins() != 1 {
+		t.Errorf("logins = %d, want 1", server.Logins())
+	}
+}
+
+func TestHTTPClientSessionExpired(t *testing.T) {
+	server, team := newTestServer(t)
+
+	client := newTestClient(server, "hunter2")
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the session dies early, the client logs in again and retries
+	server.ExpireSessions()
+
+	attendance, err := client.GetAttendance(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attendance) != len(team.Weeks) {
+		t.Errorf("got %d weeks, want %d", len(attendance), len(team.Weeks))
+	}
+
+	if server.Logins() != 2 {
+		t.Errorf("logins = %d, want 2", server.Logins())
+	}
+}
+
+func TestHTTPClientSessionExpiredLoginFails(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	client := newTestClient(server, "hunter2")
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the password changed since the last login
+	server.ExpireSessions()
+	server.Password = "changed"
+
+	players, err := client.GetTeam(context.Background(), "2001")
+	if !errors.Is(err, ocua.ErrSessionExpired) || !errors.Is(err, ocua.ErrBadCredentials) {
+		t.Fatalf("expected ErrSessionExpired and ErrBadCredentials, got %v", err)
+	}
+
+	if players != nil {
+		t.Errorf("expected no players, got %v", players)
+	}
+}
+
+func TestHTTPClientRestoresSavedSession(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	store := &ocua.CookieStore{
+		Path: filepath.Join(t.TempDir(), "session.enc"),
+		Key:  bytes.Repeat([]byte{1}, 32),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newTestClient(server, "hunter2")
+	client.Store = store
+	if err := client.RunBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted client reuses the saved session instead of logging in
+	restarted := newTestClient(server, "hunter2")
+	restarted.Store = store
+	if err := restarted.RunBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := restarted.GetTeam(context.Background(), "2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Logins() != 1 {
+		t.Errorf("logins = %d, want 1", server.Logins())
+	}
+}
+
+func TestHTTPClientSkipsRejectedSavedSession(t *testing.T) {
+	// drupal 7 shows the login form at /user instead of redirecting
+	for _, loginForm := range []bool{false, true} {
+		t.Run(fmt.Sprintf("login form %t", loginForm), func(t *testing.T) {
+			server, _ := newTestServer(t)
+			server.UserLoginForm = loginForm
+
+			store := &ocua.CookieStore{
+				Path: filepath.Join(t.TempDir(), "session.enc"),
+				Key:  bytes.Repeat([]byte{1}, 32),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := newTestClient(server, "hunter2")
+			client.Store = store
+			if err := client.RunBackground(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			// the saved session was logged out while the bot was stopped
+			server.ExpireSessions()
+
+			restarted := newTestClient(server, "hunter2")
+			restarted.Store = store
+			if err := restarted.RunBackground(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if server.Logins() != 2 {
+				t.Errorf("logins = %d, want 2", server.Logins())
+			}
+
+			_, err := restarted.GetTeam(context.Background(), "2001")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if server.Logins() != 2 {
+				t.Errorf("logins = %d after fetching the team, want 2", server.Logins())
+			}
+		})
+	}
+}
+
+func TestHTTPClientStartupTimeout(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := newTestClient(server, "wrong")
+	client.StartupTimeout = time.Millisecond * 200
+
+	updates := make(chan ocua.Health, 1)
+	client.OnHealth = func(health ocua.Health) {
+		updates <- health
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := client.RunBackground(ctx)
+	if !errors.Is(err, ocua.ErrBadCredentials) {
+		t.Fatalf("err = %v, want ErrBadCredentials", err)
+	}
+
+	health := <-updates
+	if health.ConsecutiveFailures != 1 || !health.LastSuccess.IsZero() {
+		t.Errorf("health = %+v, want one failure", health)
+	}
+
+	if client.Health().Healthy(time.Now()) {
+		t.Error("expected the client to be unhealthy")
+	}
+}
+
+func TestHTTPClientHealth(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := newTestClient(server, "hunter2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := client.RunBackground(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	health := client.Health()
+	if !health.Healthy(time.Now()) || health.LastSuccess.IsZero() || health.Expires.IsZero() {
+		t.Errorf("health = %+v, want healthy", health)
+	}
+}
+
+func TestHTTPClientHealthAfterFailedRequestLogin(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := newTestClient(server, "hunter2")
+
+	updates := make(chan ocua.Health, 2)
+	client.OnHealth = func(health ocua.Health) {
+		updates <- health
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := client.RunBackground(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-updates
+
+	// the password was changed and the session ended before the next refresh
+	client.Password = "rotated"
+	server.ExpireSessions()
+
+	_, err = client.GetTeam(context.Background(), "2001")
+	if !errors.Is(err, ocua.ErrBadCredentials) {
+		t.Fatalf("err = %v, want ErrBadCredentials", err)
+	}
+
+	health := <-updates
+	if health.ConsecutiveFailures != 1 || !errors.Is(health.LastError, ocua.ErrBadCredentials) {
+		t.Errorf("health = %+v, want one failure", health)
+	}
+
+	if client.Health().Healthy(time.Now()) {
+		t.Error("expected the client to be unhealthy")
+	}
+}
+
+func TestHTTPClientCancelled(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := newTestClient(server, "hunter2")
+
+	_, err := client.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = client.GetTeam(ctx, "2001")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestCookieStoreWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.enc")
+
+	store := &ocua.CookieStore{Path: path, Key: bytes.Repeat([]byte{1}, 32)}
+	err := store.Save([]*http.Cookie{{Name: "SSESSabc", Value: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Fatal("expected the saved cookies to be encrypted")
+	}
+
+	cookies := []*http.Cookie{}
+	err = (&ocua.CookieStore{Path: path, Key: bytes.Repeat([]byte{2}, 32)}).Load(&cookies)
+	if err == nil {
+		t.Fatal("expected loading with the wrong key to fail")
+	}
+}
@@ -1,28 +1,93 @@
 package ocua
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
 	"github.com/playwright-community/playwright-go"
 )
 
-func Login(email, password string, context playwright.BrowserContext) error {
-	page, err := context.NewPage()
+var (
+	// ErrBadCredentials is returned when OCUA rejects the username or password
+	ErrBadCredentials = errors.New("unrecognized username or password")
+	// ErrRateLimited is returned when OCUA blocks logins after too many failed
+	// attempts or asks for a CAPTCHA
+	ErrRateLimited = errors.New("login rate limited")
+	// ErrUnexpectedPage is returned when OCUA responds with a page the client
+	// doesn't recognize
+	ErrUnexpectedPage = errors.New("unexpected page")
+)
+
+// checkLoginResult classifies the page shown after submitting the login form.
+// returns nil if the login form is gone and there are no error messages
+func checkLoginResult(page io.Reader) error {
+	doc, err := goquery.NewDocumentFromReader(page)
 	if err != nil {
 		return err
 	}
-	defer page.Close()
 
-	_, err = page.Goto("/user/login")
+	message := strings.Join(strings.Fields(doc.Find(".messages.error, .messages--error, [role=alert]").First().Text()), " ")
+	lower := strings.ToLower(message)
+
+	switch {
+	case strings.Contains(lower, "unrecognized username or password"):
+		return fmt.Errorf("%w: %s", ErrBadCredentials, message)
+	case strings.Contains(lower, "failed login attempts"), strings.Contains(lower, "temporarily blocked"):
+		return fmt.Errorf("%w: %s", ErrRateLimited, message)
+	case strings.Contains(lower, "captcha"), doc.Find(".captcha, .g-recaptcha, [name=captcha_response]").Length() > 0:
+		return fmt.Errorf("%w: CAPTCHA required", ErrRateLimited)
+	case message != "":
+		return fmt.Errorf("%w: %s", ErrUnexpectedPage, message)
+	case doc.Find("#edit-pass").Length() > 0:
+		return fmt.Errorf("%w: still on the login form after submitting it", ErrUnexpectedPage)
+	}
+
+	return nil
+}
+
+func Login(ctx context.Context, email, password string, browserContext playwright.BrowserContext) error {
+	page, closePage, err := newPage(ctx, browserContext)
 	if err != nil {
 		return err
 	}
+	defer closePage()
 
-	page.Locator("#edit-name").First().Fill(email)
-	page.Locator("#edit-pass").First().Fill(password)
+	_, err = page.Goto("/user/login")
+	if err != nil {
+		return contextError(ctx, err)
+	}
 
+	err = page.Locator("#edit-name").First().Fill(email)
+	if err != nil {
+		return contextError(ctx, fmt.Errorf("%w: failed to fill username: %s", ErrUnexpectedPage, err))
+	}
+
+	err = page.Locator("#edit-pass").First().Fill(password)
+	if err != nil {
+		return contextError(ctx, fmt.Errorf("%w: failed to fill password: %s", ErrUnexpectedPage, err))
+	}
+
+	// clicking waits for the navigation to start, then wait for the next page to load
 	err = page.Locator("#edit-submit").Click()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 
-	return nil
+	err = page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
+		State: playwright.LoadStateLoad,
+	})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	content, err := page.Content()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return checkLoginResult(strings.NewReader(content))
 }
@@ -0,0 +1,537 @@
+// Package ocuatest provides a fake OCUA/Zuluru server for testing without
+// network access or real credentials
+package ocuatest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+// SessionCookie is the name of the session cookie issued by the server
+const SessionCookie = "SSESSocuatest"
+
+// Week is a column on a team's attendance page
+type Week struct {
+	Gametime time.Time
+	DateOnly bool // render the header without a time
+	Players  map[string]ocua.AttendanceStatus
+	Game     *ocua.Game // row on the team's schedule page, nil for a bye
+	Locked   bool       // attendance changes are rejected with an error on the change form
+}
+
+// Team is the state rendered on a team's view, attendance and schedule pages
+type Team struct {
+	Players []ocua.Player
+	Weeks   []*Week
+}
+
+// Server is a fake OCUA server. it serves the drupal login form, issues session
+// cookies and renders zuluru team and attendance pages from in memory state
+type Server struct {
+	*httptest.Server
+
+	Username   string
+	Password   string
+	SessionTTL time.Duration // defaults to 30 days
+	MaxFailed  int           // failed logins before the account is blocked like drupal's flood control, 0 never blocks
+
+	// serve the login form at /user without a session like drupal 7 does,
+	// instead of redirecting to /user/login
+	UserLoginForm bool
+
+	mu       sync.Mutex
+	teams    map[string]*Team
+	sessions map[string]time.Time // map of session id -> expiry
+	errors   map[string]int       // map of path -> forced status code
+	logins   int
+	failed   int
+}
+
+// NewServer starts a fake OCUA server that accepts the given credentials
+func NewServer(username, password string) *Server {
+	server := NewUnstartedServer(username, password)
+	server.Start()
+	return server
+}
+
+// NewUnstartedServer returns a fake OCUA server that isn't started, the listener
+// can be replaced before calling Start to serve on a specific address
+func NewUnstartedServer(username, password string) *Server {
+	server := &Server{
+		Username: username,
+		Password: password,
+		teams:    map[string]*Team{},
+		sessions: map[string]time.Time{},
+		errors:   map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/login", server.handleLogin)
+	mux.HandleFunc("/user", server.handleUser)
+	mux.HandleFunc("/zuluru/teams/view", server.requireSession(server.handleTeam))
+	mux.HandleFunc("/zuluru/teams/attendance", server.requireSession(server.handleAttendance))
+	mux.HandleFunc("/zuluru/teams/schedule", server.requireSession(server.handleSchedule))
+	mux.HandleFunc("/zuluru/games/attendance_change", server.requireSession(server.handleAttendanceChange))
+
+	server.Server = httptest.NewUnstartedServer(server.forceErrors(mux))
+	return server
+}
+
+// SetTeam replaces the state of a team
+func (server *Server) SetTeam(teamID string, team *Team) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.teams[teamID] = team
+}
+
+// Status returns a player's attendance for the game on date ("YYYY-mm-dd")
+func (server *Server) Status(teamID, playerID, date string) ocua.AttendanceStatus {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	week := server.findWeek(teamID, date)
+	if week == nil {
+		return ""
+	}
+	return week.Players[playerID]
+}
+
+// SetStatus changes a player's attendance for the game on date ("YYYY-mm-dd")
+func (server *Server) SetStatus(teamID, playerID, date string, status ocua.AttendanceStatus) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	week := server.findWeek(teamID, date)
+	if week != nil {
+		week.Players[playerID] = status
+	}
+}
+
+// ExpireSessions ends every session as if they were logged out server side
+func (server *Server) ExpireSessions() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.sessions = map[string]time.Time{}
+}
+
+// SetError makes every request to path respond with the status code and an
+// error page. a status code of 0 clears the error
+func (server *Server) SetError(path string, status int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if status == 0 {
+		delete(server.errors, path)
+		return
+	}
+	server.errors[path] = status
+}
+
+// Logins returns the number of successful logins
+func (server *Server) Logins() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.logins
+}
+
+func (server *Server) findWeek(teamID, date string) *Week {
+	team, ok := server.teams[teamID]
+	if !ok {
+		return nil
+	}
+
+	for _, week := range team.Weeks {
+		if week.Gametime.Format("2006-01-02") == date {
+			return week
+		}
+	}
+	return nil
+}
+
+// findGame returns the team's week with the zuluru game id
+func (server *Server) findGame(teamID, gameID string) *Week {
+	team, ok := server.teams[teamID]
+	if !ok {
+		return nil
+	}
+
+	for _, week := range team.Weeks {
+		if week.Game != nil && week.Game.ID == gameID {
+			return week
+		}
+	}
+	return nil
+}
+
+func randomToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (server *Server) forceErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		status, ok := server.errors[r.URL.Path]
+		server.mu.Unlock()
+
+		if ok {
+			w.WriteHeader(status)
+			render(w, errorTemplate, http.StatusText(status))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireSession redirects to the login page like drupal does when the session
+// cookie is missing or expired
+func (server *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if server.hasSession(r) {
+			next(w, r)
+			return
+		}
+
+		destination := url.QueryEscape(strings.TrimPrefix(r.URL.RequestURI(), "/"))
+		http.Redirect(w, r, "/user/login?destination="+destination, http.StatusFound)
+	}
+}
+
+// hasSession returns true if the request has a session cookie that hasn't expired
+func (server *Server) hasSession(r *http.Request) bool {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return false
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	expires, ok := server.sessions[cookie.Value]
+	return ok && time.Now().Before(expires)
+}
+
+func (server *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		render(w, loginTemplate, loginPage{FormBuildID: "form-" + randomToken()})
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil || r.PostForm.Get("form_id") != "user_login" || r.PostForm.Get("form_build_id") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, errorTemplate, "Invalid form submission")
+		return
+	}
+
+	server.mu.Lock()
+	blocked := server.MaxFailed > 0 && server.failed >= server.MaxFailed
+	server.mu.Unlock()
+
+	if blocked {
+		render(w, loginTemplate, loginPage{
+			FormBuildID: "form-" + randomToken(),
+			Error:       fmt.Sprintf("Sorry, there have been more than %d failed login attempts for this account. It is temporarily blocked. Try again later or request a new password.", server.MaxFailed),
+		})
+		return
+	}
+
+	if r.PostForm.Get("name") != server.Username || r.PostForm.Get("pass") != server.Password {
+		server.mu.Lock()
+		server.failed++
+		server.mu.Unlock()
+
+		render(w, loginTemplate, loginPage{
+			FormBuildID: "form-" + randomToken(),
+			Error:       "Sorry, unrecognized username or password. Have you forgotten your password?",
+		})
+		return
+	}
+
+	ttl := server.SessionTTL
+	if ttl == 0 {
+		ttl = time.Hour * 24 * 30
+	}
+
+	session := randomToken()
+	expires := time.Now().Add(ttl)
+
+	server.mu.Lock()
+	server.sessions[session] = expires
+	server.logins++
+	server.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    session,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+	})
+
+	destination := "/" + r.URL.Query().Get("destination")
+	if destination == "/" {
+		destination = "/user"
+	}
+	http.Redirect(w, r, destination, http.StatusFound)
+}
+
+func (server *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	if !server.hasSession(r) && server.UserLoginForm {
+		render(w, loginTemplate, loginPage{FormBuildID: "form-" + randomToken()})
+		return
+	}
+
+	server.requireSession(func(w http.ResponseWriter, r *http.Request) {
+		render(w, userTemplate, server.Username)
+	})(w, r)
+}
+
+func (server *Server) getTeam(w http.ResponseWriter, r *http.Request) (string, *Team, bool) {
+	teamID := r.URL.Query().Get("team")
+
+	server.mu.Lock()
+	team, ok := server.teams[teamID]
+	server.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		render(w, errorTemplate, "Invalid team")
+		return "", nil, false
+	}
+
+	return teamID, team, true
+}
+
+func sortedPlayers(team *Team) []ocua.Player {
+	players := make([]ocua.Player, len(team.Players))
+	copy(players, team.Players)
+
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+	return players
+}
+
+func (server *Server) handleTeam(w http.ResponseWriter, r *http.Request) {
+	teamID, team, ok := server.getTeam(w, r)
+	if !ok {
+		return
+	}
+
+	server.mu.Lock()
+	page := teamPage{TeamID: teamID, Players: sortedPlayers(team)}
+	server.mu.Unlock()
+
+	render(w, teamTemplate, page)
+}
+
+func (server *Server) handleAttendance(w http.ResponseWriter, r *http.Request) {
+	teamID, team, ok := server.getTeam(w, r)
+	if !ok {
+		return
+	}
+
+	server.mu.Lock()
+	page := attendancePage{TeamID: teamID}
+
+	for _, week := range team.Weeks {
+		if week.DateOnly {
+			page.Headers = append(page.Headers, week.Gametime.Format("Jan 2, 2006"))
+		} else {
+			page.Headers = append(page.Headers, week.Gametime.Format("Jan 2, 2006 3:04PM"))
+		}
+	}
+
+	for _, player := range sortedPlayers(team) {
+		row := attendanceRow{Player: player}
+		for _, week := range team.Weeks {
+			cell := attendanceCell{}
+
+			status, ok := week.Players[player.ID]
+			if ok {
+				cell.Status = string(status[:1]) + strings.ToLower(string(status[1:]))
+				// zuluru links to the game, weeks without one are linked by date
+				if week.Game != nil {
+					cell.ChangeURL = fmt.Sprintf("/zuluru/games/attendance_change?team=%s&game=%s&person=%s", teamID, week.Game.ID, player.ID)
+				} else {
+					cell.ChangeURL = fmt.Sprintf("/zuluru/games/attendance_change?team=%s&date=%s&person=%s", teamID, week.Gametime.Format("2006-01-02"), player.ID)
+				}
+			}
+
+			row.Cells = append(row.Cells, cell)
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	server.mu.Unlock()
+
+	render(w, attendanceTemplate, page)
+}
+
+func (server *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	teamID, team, ok := server.getTeam(w, r)
+	if !ok {
+		return
+	}
+
+	server.mu.Lock()
+	page := schedulePage{TeamID: teamID}
+
+	for _, week := range team.Weeks {
+		if week.Game == nil {
+			continue
+		}
+
+		row := scheduleRow{
+			Date:     week.Game.Start.Format("Mon Jan 2, 2006"),
+			Time:     week.Game.Start.Format("3:04PM"),
+			Game:     *week.Game,
+			HomeAway: "away",
+		}
+		if !week.Game.End.IsZero() {
+			row.Time += "-" + week.Game.End.Format("3:04PM")
+		}
+		if week.Game.Home {
+			row.HomeAway = "home"
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	server.mu.Unlock()
+
+	render(w, scheduleTemplate, page)
+}
+
+var statusCodes = map[string]ocua.AttendanceStatus{
+	"0": ocua.UNKNOWN,
+	"1": ocua.ATTENDING,
+	"2": ocua.ABSENT,
+	"3": ocua.INVITED,
+	"4": ocua.AVAILABLE,
+}
+
+func (server *Server) handleAttendanceChange(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	teamID, playerID := query.Get("team"), query.Get("person")
+
+	server.mu.Lock()
+	week := server.findWeek(teamID, query.Get("date"))
+	if gameID := query.Get("game"); gameID != "" {
+		week = server.findGame(teamID, gameID)
+	}
+	server.mu.Unlock()
+
+	if week == nil {
+		w.WriteHeader(http.StatusNotFound)
+		render(w, errorTemplate, "Invalid game")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		render(w, attendanceChangeTemplate, attendanceChangePage{CSRFToken: randomToken()})
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil || r.PostForm.Get("_csrfToken") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, errorTemplate, "Invalid form submission")
+		return
+	}
+
+	status, ok := statusCodes[r.PostForm.Get("status")]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, errorTemplate, "Invalid status")
+		return
+	}
+
+	// zuluru shows the form again with a flash message when it rejects a change
+	server.mu.Lock()
+	locked := week.Locked
+	server.mu.Unlock()
+
+	if locked {
+		render(w, attendanceChangeTemplate, attendanceChangePage{
+			CSRFToken: randomToken(),
+			Error:     "Attendance for this game can no longer be changed.",
+		})
+		return
+	}
+
+	server.mu.Lock()
+	week.Players[playerID] = status
+	server.mu.Unlock()
+
+	http.Redirect(w, r, "/zuluru/teams/attendance?team="+teamID, http.StatusFound)
+}
+
+func render(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	t.Execute(w, data)
+}
+
+// SampleTeam returns a small mixed team with weekly games starting a week
+// before start, useful for seeding the server
+func SampleTeam(start time.Time) *Team {
+	players := []ocua.Player{
+		{ID: "1001", Name: "Alex Martin", Role: "Captain", Gender: "O"},
+		{ID: "1002", Name: "Blair Chen", Role: "Assistant captain", Gender: "W"},
+		{ID: "1003", Name: "Casey Patel", Role: "Regular player", Gender: "O"},
+		{ID: "1004", Name: "Devon Roy", Role: "Regular player", Gender: "W"},
+		{ID: "1005", Name: "Emery Singh", Role: "Substitute player", Gender: "W"},
+		{ID: "1006", Name: "Frankie Cote", Role: "Substitute player", Gender: "O"},
+	}
+
+	first := time.Date(start.Year(), start.Month(), start.Day(), 18, 45, 0, 0, time.Local).AddDate(0, 0, -7)
+
+	opponents := []struct{ ID, Name string }{
+		{ID: "2101", Name: "Huckin' Eh"},
+		{ID: "2102", Name: "Layout Legends"},
+		{ID: "2103", Name: "Disc Jockeys"},
+		{ID: "2104", Name: "Stall Seven"},
+	}
+
+	weeks := []*Week{}
+	for i := 0; i < 4; i++ {
+		gametime := first.AddDate(0, 0, 7*i)
+		week := &Week{
+			Gametime: gametime,
+			Players:  map[string]ocua.AttendanceStatus{},
+			Game: &ocua.Game{
+				ID:           fmt.Sprint(30001 + i),
+				Start:        gametime,
+				End:          gametime.Add(time.Minute * 90),
+				OpponentID:   opponents[i].ID,
+				OpponentName: opponents[i].Name,
+				FieldName:    fmt.Sprintf("Brewer Park %d", i%2+1),
+				FieldCode:    fmt.Sprintf("BRE %d", i%2+1),
+				Home:         i%2 == 0,
+			},
+		}
+		for _, player := range players {
+			week.Players[player.ID] = ocua.UNKNOWN
+		}
+		weeks = append(weeks, week)
+	}
+
+	weeks[0].Players["1001"] = ocua.ATTENDING
+	weeks[0].Players["1002"] = ocua.ATTENDING
+	weeks[0].Players["1003"] = ocua.ABSENT
+	weeks[1].Players["1001"] = ocua.ATTENDING
+	weeks[1].Players["1004"] = ocua.AVAILABLE
+
+	return &Team{Players: players, Weeks: weeks}
+}
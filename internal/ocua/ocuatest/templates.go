@@ -0,0 +1,195 @@
+package ocuatest
+
+import (
+	"html/template"
+
+	"github.com/danielholmes839/ocua-attendance-bot/internal/ocua"
+)
+
+type loginPage struct {
+	FormBuildID string
+	Error       string
+}
+
+type teamPage struct {
+	TeamID  string
+	Players []ocua.Player
+}
+
+type attendanceCell struct {
+	Status    string // empty if the player can't attend the game
+	ChangeURL string
+}
+
+type attendanceRow struct {
+	Player ocua.Player
+	Cells  []attendanceCell
+}
+
+type attendancePage struct {
+	TeamID  string
+	Headers []string
+	Rows    []attendanceRow
+}
+
+type attendanceChangePage struct {
+	CSRFToken string
+	Error     string
+}
+
+type scheduleRow struct {
+	Date     string
+	Time     string
+	Game     ocua.Game
+	HomeAway string
+}
+
+type schedulePage struct {
+	TeamID string
+	Rows   []scheduleRow
+}
+
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Error</title></head>
+<body>
+<div class="messages error">{{.}}</div>
+</body>
+</html>
+`))
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>User account</title></head>
+<body>
+{{if .Error}}<div class="messages error">{{.Error}}</div>{{end}}
+<form action="/user/login" method="post" id="user-login">
+<input type="text" id="edit-name" name="name" value="">
+<input type="password" id="edit-pass" name="pass">
+<input type="hidden" name="form_build_id" value="{{.FormBuildID}}">
+<input type="hidden" name="form_id" value="user_login">
+<input type="submit" id="edit-submit" name="op" value="Log in">
+</form>
+</body>
+</html>
+`))
+
+var userTemplate = template.Must(template.New("user").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.}}</title></head>
+<body>
+<h1>{{.}}</h1>
+</body>
+</html>
+`))
+
+var teamTemplate = template.Must(template.New("team").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Team</title></head>
+<body>
+<div class="related row">
+<h3>Team Roster</h3>
+<table class="table table-striped table-hover table-condensed">
+<tbody>
+<tr>
+<th>Name</th>
+<th>Role</th>
+<th>Gender</th>
+</tr>
+{{range .Players}}<tr>
+<td><a href="/zuluru/people/view?person={{.ID}}">{{.Name}}</a></td>
+<td><a href="/zuluru/teams/roster_role?team={{$.TeamID}}&amp;person={{.ID}}">{{.Role}}</a></td>
+<td>{{if eq .Gender "W"}}Woman{{else}}Open{{end}}</td>
+</tr>
+{{end}}<tr>
+<td colspan="3">Total: {{len .Players}} players</td>
+</tr>
+</tbody>
+</table>
+</div>
+</body>
+</html>
+`))
+
+var attendanceTemplate = template.Must(template.New("attendance").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Team Attendance</title></head>
+<body>
+<div class="teams attendance">
+<table class="table table-striped table-hover table-condensed">
+<thead>
+<tr>
+<th>Name</th>
+{{range .Headers}}<th>{{.}}</th>
+{{end}}<th>Total</th>
+<th>Actions</th>
+</tr>
+</thead>
+<tbody>
+{{range .Rows}}<tr>
+<td><a href="/zuluru/people/view?person={{.Player.ID}}">{{.Player.Name}}</a></td>
+{{range .Cells}}{{if .Status}}<td><a href="{{.ChangeURL}}"><img src="/zuluru/img/attendance.png" title="Current attendance: {{.Status}}"></a></td>
+{{else}}<td>N/A</td>
+{{end}}{{end}}<td></td>
+<td></td>
+</tr>
+{{end}}<tr>
+<td></td>
+{{range .Headers}}<td></td>
+{{end}}<td></td>
+<td></td>
+</tr>
+</tbody>
+</table>
+</div>
+</body>
+</html>
+`))
+
+var scheduleTemplate = template.Must(template.New("schedule").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Team Schedule</title></head>
+<body>
+<div class="teams schedule">
+<table class="table table-striped table-hover table-condensed">
+<thead>
+<tr>
+<th>Date</th>
+<th>Time</th>
+<th>Opponent</th>
+<th>Location</th>
+<th>Score</th>
+</tr>
+</thead>
+<tbody>
+{{range .Rows}}<tr>
+<td>{{.Date}}</td>
+<td>{{.Time}}</td>
+<td>{{if .Game.OpponentID}}<a href="/zuluru/teams/view?team={{.Game.OpponentID}}">{{.Game.OpponentName}}</a>{{else}}TBD{{end}} ({{.HomeAway}})</td>
+<td><a href="/zuluru/facilities/view?field={{.Game.FieldCode}}" title="{{.Game.FieldName}}">{{.Game.FieldCode}}</a></td>
+<td><a href="/zuluru/games/view?game={{.Game.ID}}">Details</a></td>
+</tr>
+{{end}}</tbody>
+</table>
+</div>
+</body>
+</html>
+`))
+
+var attendanceChangeTemplate = template.Must(template.New("attendance_change").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Attendance Change</title></head>
+<body>
+{{if .Error}}<div class="alert alert-danger">{{.Error}}</div>{{end}}
+<form method="post">
+<input type="hidden" name="_csrfToken" value="{{.CSRFToken}}">
+<label><input type="radio" name="status" value="1"> Attending</label>
+<label><input type="radio" name="status" value="2"> Absent</label>
+<label><input type="radio" name="status" value="3"> Invited</label>
+<label><input type="radio" name="status" value="4"> Available</label>
+<label><input type="radio" name="status" value="0"> Unknown</label>
+<input type="submit" value="Submit">
+</form>
+</body>
+</html>
+`))
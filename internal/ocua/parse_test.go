@@ -0,0 +1,331 @@
+package ocua
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// goldenAttendance is the golden representation of a week. the game time is
+// formatted without a zone so golden files don't depend on the local time zone
+type goldenAttendance struct {
+	Gametime   string
+	Players    map[string]AttendanceStatus
+	ChangeURLs map[string]string
+}
+
+func toGoldenAttendance(weeks []Attendance) []goldenAttendance {
+	golden := []goldenAttendance{}
+	for _, week := range weeks {
+		golden = append(golden, goldenAttendance{
+			Gametime:   week.Gametime.Format("2006-01-02 15:04"),
+			Players:    week.Players,
+			ChangeURLs: week.ChangeURLs,
+		})
+	}
+	return golden
+}
+
+// goldenGame is the golden representation of a game, formatted without a zone
+// like goldenAttendance
+type goldenGame struct {
+	ID           string
+	Start        string
+	End          string
+	OpponentID   string
+	OpponentName string
+	FieldName    string
+	FieldCode    string
+	Home         bool
+}
+
+func toGoldenGames(games []Game) []goldenGame {
+	golden := []goldenGame{}
+	for _, game := range games {
+		end := ""
+		if !game.End.IsZero() {
+			end = game.End.Format("2006-01-02 15:04")
+		}
+
+		golden = append(golden, goldenGame{
+			ID:           game.ID,
+			Start:        game.Start.Format("2006-01-02 15:04"),
+			End:          end,
+			OpponentID:   game.OpponentID,
+			OpponentName: game.OpponentName,
+			FieldName:    game.FieldName,
+			FieldCode:    game.FieldCode,
+			Home:         game.Home,
+		})
+	}
+	return golden
+}
+
+// assertGolden compares v as json with testdata/<name>.golden.json
+func assertGolden(t *testing.T, name string, v any) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", name+".golden.json")
+
+	if *update {
+		err = os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run with -update to create it: %s", err)
+	}
+
+	if string(got) != string(want) {
+		t.Errorf("%s doesn't match golden file\n\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// fixtures returns the testdata pages matching pattern. none of the pages have
+// been captured from OCUA yet, they were written by hand and are marked with a
+// comment, so the golden files only check the parsers against the markup they
+// expect. the schedule page is the least certain: its div.teams.schedule
+// wrapper, column headers and "(home)" marker are guesses. replace each page
+// with one saved by cmd/fixtures, then run with -update
+func fixtures(t *testing.T, pattern string) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) == 0 {
+		t.Fatalf("no fixtures matching %q", pattern)
+	}
+
+	return paths
+}
+
+func fixtureName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".html")
+}
+
+func TestParseAttendancePage(t *testing.T) {
+	for _, path := range fixtures(t, "attendance_*.html") {
+		t.Run(fixtureName(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			weeks, err := ParseAttendancePage(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, fixtureName(path), toGoldenAttendance(weeks))
+		})
+	}
+}
+
+func TestParseTeamPage(t *testing.T) {
+	for _, path := range fixtures(t, "team_*.html") {
+		t.Run(fixtureName(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			players, err := ParseTeamPage(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, fixtureName(path), players)
+		})
+	}
+}
+
+func TestParseSchedulePage(t *testing.T) {
+	for _, path := range fixtures(t, "schedule_*.html") {
+		t.Run(fixtureName(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			games, err := ParseSchedulePage(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, fixtureName(path), toGoldenGames(games))
+		})
+	}
+}
+
+func TestJoinSchedule(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "schedule_basic.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	games, err := ParseSchedulePage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weeks := []Attendance{
+		{Gametime: time.Date(2024, 5, 20, 18, 45, 0, 0, time.Local)},
+		{Gametime: time.Date(2024, 5, 27, 0, 0, 0, 0, time.Local)},  // date only
+		{Gametime: time.Date(2024, 6, 3, 18, 45, 0, 0, time.Local)}, // moved from 8:30PM
+		{Gametime: time.Date(2024, 6, 10, 18, 45, 0, 0, time.Local)},
+	}
+
+	joined := JoinSchedule(weeks, games)
+
+	want := []string{"3001", "3002", "", ""}
+	for i, week := range joined {
+		got := ""
+		if week.Game != nil {
+			got = week.Game.ID
+		}
+		if got != want[i] {
+			t.Errorf("week %d game = %q, want %q", i, got, want[i])
+		}
+	}
+
+	if weeks[0].Game != nil {
+		t.Error("JoinSchedule() changed the weeks it was given")
+	}
+}
+
+func TestParseAttendanceGametime(t *testing.T) {
+	tests := []struct {
+		text  string
+		want  string
+		valid bool
+	}{
+		{"May 20, 2024 6:45PM", "2024-05-20 18:45", true},
+		{"Jul 1, 2024", "2024-07-01 00:00", true},
+		{"Playoffs", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		gametime, err := parseAttendanceGametime(test.text)
+		if (err == nil) != test.valid {
+			t.Errorf("parseAttendanceGametime(%q) error = %v, want valid %v", test.text, err, test.valid)
+			continue
+		}
+
+		if test.valid && gametime.Format("2006-01-02 15:04") != test.want {
+			t.Errorf("parseAttendanceGametime(%q) = %s, want %s", test.text, gametime.Format("2006-01-02 15:04"), test.want)
+		}
+	}
+}
+
+func TestCheckLoginResult(t *testing.T) {
+	loginForm := `<form id="user-login"><input id="edit-name" name="name"><input id="edit-pass" name="pass" type="password"></form>`
+
+	tests := []struct {
+		name string
+		page string
+		want error
+	}{
+		{"logged in", `<h1>My Account</h1>`, nil},
+		{"bad credentials", `<div class="messages error">Sorry, unrecognized username or password. Have you forgotten your password?</div>` + loginForm, ErrBadCredentials},
+		{"account blocked", `<div class="messages error">Sorry, there have been more than 5 failed login attempts for this account. It is temporarily blocked.</div>` + loginForm, ErrRateLimited},
+		{"ip blocked", `<div class="messages error">Sorry, too many failed login attempts from your IP address. This IP address is temporarily blocked.</div>` + loginForm, ErrRateLimited},
+		{"captcha", `<form id="user-login"><div class="captcha"><input name="captcha_response"></div></form>`, ErrRateLimited},
+		{"other error", `<div class="messages error">The website encountered an unexpected error.</div>`, ErrUnexpectedPage},
+		{"login form", loginForm, ErrUnexpectedPage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkLoginResult(strings.NewReader(test.page))
+			if !errors.Is(err, test.want) || (test.want == nil && err != nil) {
+				t.Errorf("checkLoginResult() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckAttendanceChangeResult(t *testing.T) {
+	changeForm := `<form method="post"><input type="radio" name="status" value="1"><input type="submit" value="Submit"></form>`
+
+	tests := []struct {
+		name string
+		page string
+		want error
+	}{
+		{"saved", `<div class="teams attendance"><table></table></div>`, nil},
+		{"flash error", `<div class="alert alert-danger">Attendance for this game can no longer be changed.</div>` + changeForm, ErrUnexpectedPage},
+		{"drupal error", `<div class="messages error">The website encountered an unexpected error.</div>`, ErrUnexpectedPage},
+		{"change form", changeForm, ErrUnexpectedPage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAttendanceChangeResult(strings.NewReader(test.page))
+			if !errors.Is(err, test.want) || (test.want == nil && err != nil) {
+				t.Errorf("checkAttendanceChangeResult() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckLoggedIn(t *testing.T) {
+	loginForm := `<form id="user-login"><input id="edit-name" name="name"><input id="edit-pass" name="pass" type="password"></form>`
+	if err := checkLoggedIn("/user", strings.NewReader(loginForm)); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("checkLoggedIn() = %v, want ErrSessionExpired", err)
+	}
+
+	account := `<h1 class="page-title">captain@example.com</h1>`
+	if err := checkLoggedIn("/user", strings.NewReader(account)); err != nil {
+		t.Errorf("checkLoggedIn() = %v, want nil", err)
+	}
+}
+
+func TestParseLoginPageIsUnexpected(t *testing.T) {
+	page := `<form id="user-login"><input id="edit-name" name="name"><input id="edit-pass" name="pass" type="password"></form>`
+
+	_, err := ParseAttendancePage(strings.NewReader(page))
+	if !errors.Is(err, ErrUnexpectedPage) {
+		t.Errorf("ParseAttendancePage() = %v, want ErrUnexpectedPage", err)
+	}
+
+	_, err = ParseTeamPage(strings.NewReader(page))
+	if !errors.Is(err, ErrUnexpectedPage) {
+		t.Errorf("ParseTeamPage() = %v, want ErrUnexpectedPage", err)
+	}
+
+	_, err = ParseSchedulePage(strings.NewReader(page))
+	if !errors.Is(err, ErrUnexpectedPage) {
+		t.Errorf("ParseSchedulePage() = %v, want ErrUnexpectedPage", err)
+	}
+}
@@ -0,0 +1,207 @@
+package ocua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Health is the state of a client's session
+type Health struct {
+	LastSuccess         time.Time // last successful login, zero if it never logged in
+	Expires             time.Time // when the session cookie expires
+	ConsecutiveFailures int       // failed logins since the last success
+	LastError           error     // error from the last failed login
+}
+
+// Healthy returns true if the last login worked and the session hasn't expired
+func (health Health) Healthy(now time.Time) bool {
+	return health.ConsecutiveFailures == 0 && now.Before(health.Expires)
+}
+
+// defaultStartupTimeout is how long RunBackground waits for a session by default
+const defaultStartupTimeout = 5 * time.Minute
+
+const (
+	// defaultSessionLifetime is how long a session cookie without an expiry,
+	// like a browser session cookie, is assumed to last
+	defaultSessionLifetime = 48 * time.Hour
+	// minRefreshInterval is the shortest wait between background logins
+	minRefreshInterval = time.Hour
+)
+
+// refreshDelay is how long to wait before logging in again for a session that
+// expires at expires. sessions are refreshed a day early, or halfway through
+// when they're shorter than that, and never more often than minRefreshInterval
+func refreshDelay(now, expires time.Time) time.Duration {
+	remaining := expires.Sub(now)
+	if remaining <= minRefreshInterval {
+		return minRefreshInterval
+	}
+
+	delay := max(remaining-sessionRefreshMargin, remaining/2)
+	return max(delay, minRefreshInterval)
+}
+
+// loginRetryDelay is how long to wait before logging in again after failures
+// consecutive errors. the delay doubles with each failure and is jittered so
+// restarts don't retry in lockstep. retrying bad credentials quickly would get
+// the account blocked
+func loginRetryDelay(err error, failures int) time.Duration {
+	base, limit := time.Minute, time.Hour
+	switch {
+	case errors.Is(err, ErrBadCredentials):
+		base, limit = time.Minute*30, time.Hour*6
+	case errors.Is(err, ErrRateLimited):
+		base, limit = time.Minute*15, time.Hour*2
+	}
+
+	delay := base
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+
+	// wait between half and all of the delay
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// refreshLoop logs in before the session expires and keeps track of its health.
+// it's shared by the playwright and http clients
+type refreshLoop struct {
+	login          func(context.Context) (time.Time, error) // returns when the new session expires
+	restore        func(context.Context) (time.Time, bool)  // optional, reuses a saved session
+	startupTimeout time.Duration
+	onHealth       func(Health) // optional, called after every login attempt
+	logger         *slog.Logger
+
+	mu     sync.Mutex
+	health Health
+}
+
+func (loop *refreshLoop) snapshot() Health {
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+	return loop.health
+}
+
+// record updates the health after a login attempt and returns it
+func (loop *refreshLoop) record(expires time.Time, err error) Health {
+	loop.mu.Lock()
+	if err != nil {
+		loop.health.ConsecutiveFailures++
+		loop.health.LastError = err
+	} else {
+		loop.health.LastSuccess = time.Now()
+		loop.health.Expires = expires
+		loop.health.ConsecutiveFailures = 0
+		loop.health.LastError = nil
+	}
+	health := loop.health
+	loop.mu.Unlock()
+
+	if loop.onHealth != nil {
+		loop.onHealth(health)
+	}
+	return health
+}
+
+// loginNow logs in for a request that found the session expired and records
+// the result like a background login so failures show up in the health
+func (loop *refreshLoop) loginNow(ctx context.Context) error {
+	expires, err := loop.login(ctx)
+	if ctx.Err() != nil {
+		return err
+	}
+
+	loop.record(expires, err)
+	return err
+}
+
+// run keeps the session fresh until ctx is cancelled. blocks until there's a
+// session, returns an error if there isn't one within the startup timeout or
+// ctx is cancelled first
+func (loop *refreshLoop) run(ctx context.Context) error {
+	startupTimeout := loop.startupTimeout
+	if startupTimeout == 0 {
+		startupTimeout = defaultStartupTimeout
+	}
+
+	loopCtx, cancel := context.WithCancel(ctx)
+	ready := make(chan struct{})
+
+	go func() {
+		once := sync.Once{}
+		expires, restored := time.Time{}, false
+
+		// reuse the saved session instead of logging in when possible
+		if loop.restore != nil {
+			restoreCtx, cancel := context.WithTimeout(loopCtx, loginTimeout)
+			expires, restored = loop.restore(restoreCtx)
+			cancel()
+		}
+
+		if restored {
+			loop.record(expires, nil)
+		}
+
+		for {
+			if !restored {
+				loginCtx, cancel := context.WithTimeout(loopCtx, loginTimeout)
+				var err error
+				expires, err = loop.login(loginCtx)
+				cancel()
+
+				if loopCtx.Err() != nil {
+					return
+				}
+
+				health := loop.record(expires, err)
+				if err != nil {
+					delay := loginRetryDelay(err, health.ConsecutiveFailures)
+					loop.logger.Error("failed to login", "error", err, "failures", health.ConsecutiveFailures, "retry", delay.String())
+					if !sleepContext(loopCtx, delay) {
+						return
+					}
+					continue
+				}
+
+				loop.logger.Info("successfully logged in", "expires", expires)
+			}
+			restored = false
+
+			once.Do(func() {
+				close(ready)
+			})
+
+			// sleep until the next refresh
+			if !sleepContext(loopCtx, refreshDelay(time.Now(), expires)) {
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(startupTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		// the loop runs until ctx is cancelled
+		context.AfterFunc(ctx, cancel)
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	case <-timer.C:
+		cancel()
+		health := loop.snapshot()
+		if health.LastError != nil {
+			return fmt.Errorf("no session after %s: %w", startupTimeout, health.LastError)
+		}
+		return fmt.Errorf("no session after %s", startupTimeout)
+	}
+}
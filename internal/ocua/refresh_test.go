@@ -0,0 +1,219 @@
+package ocua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+func TestLoginRetryDelay(t *testing.T) {
+	tests := []struct {
+		err      error
+		failures int
+		max      time.Duration
+	}{
+		{errors.New("timeout"), 1, time.Minute},
+		{errors.New("timeout"), 3, time.Minute * 4},
+		{errors.New("timeout"), 20, time.Hour},
+		{fmt.Errorf("%w: blocked", ErrRateLimited), 1, time.Minute * 15},
+		{fmt.Errorf("%w: wrong password", ErrBadCredentials), 1, time.Minute * 30},
+		{fmt.Errorf("%w: wrong password", ErrBadCredentials), 10, time.Hour * 6},
+	}
+
+	for _, test := range tests {
+		for range 20 {
+			delay := loginRetryDelay(test.err, test.failures)
+			if delay < test.max/2 || delay > test.max {
+				t.Errorf("loginRetryDelay(%v, %d) = %s, want between %s and %s", test.err, test.failures, delay, test.max/2, test.max)
+			}
+		}
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		expires time.Time
+		want    time.Duration
+	}{
+		{"a month", now.Add(time.Hour * 24 * 30), time.Hour * 24 * 29},
+		{"12 hours", now.Add(time.Hour * 12), time.Hour * 6},
+		{"30 minutes", now.Add(time.Minute * 30), minRefreshInterval},
+		{"expired", now.Add(-time.Hour), minRefreshInterval},
+		{"zero", time.Time{}, minRefreshInterval},
+	}
+
+	for _, test := range tests {
+		if got := refreshDelay(now, test.expires); got != test.want {
+			t.Errorf("%s: refreshDelay() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCookieExpiresWithoutExpiry(t *testing.T) {
+	near := func(got time.Time, want time.Duration) bool {
+		d := time.Until(got)
+		return d > want-time.Minute && d <= want
+	}
+
+	if got := getCookieExpires(playwright.Cookie{Name: "SSESS1", Expires: -1}); !near(got, defaultSessionLifetime) {
+		t.Errorf("browser session cookie expires %s, want in %s", got, defaultSessionLifetime)
+	}
+
+	if got := getHTTPCookieExpires(&http.Cookie{Name: "SSESS1"}); !near(got, defaultSessionLifetime) {
+		t.Errorf("http session cookie expires %s, want in %s", got, defaultSessionLifetime)
+	}
+
+	if got := getHTTPCookieExpires(&http.Cookie{Name: "SSESS1", MaxAge: 3600}); !near(got, time.Hour) {
+		t.Errorf("max-age cookie expires %s, want in 1h", got)
+	}
+}
+
+// fakeLogin counts logins and returns err, or a session that expires in a month
+type fakeLogin struct {
+	mu     sync.Mutex
+	logins int
+	err    error
+}
+
+func (login *fakeLogin) login(ctx context.Context) (time.Time, error) {
+	login.mu.Lock()
+	defer login.mu.Unlock()
+	login.logins++
+	if login.err != nil {
+		return time.Time{}, login.err
+	}
+	return time.Now().Add(time.Hour * 24 * 30), nil
+}
+
+func (login *fakeLogin) count() int {
+	login.mu.Lock()
+	defer login.mu.Unlock()
+	return login.logins
+}
+
+func TestRefreshLoopRestore(t *testing.T) {
+	login := &fakeLogin{}
+	loop := &refreshLoop{
+		login: login.login,
+		restore: func(context.Context) (time.Time, bool) {
+			return time.Now().Add(time.Hour * 24 * 7), true
+		},
+		logger: slog.Default(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := loop.run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if login.count() != 0 {
+		t.Errorf("logins = %d, want 0 after restoring", login.count())
+	}
+
+	if health := loop.snapshot(); !health.Healthy(time.Now()) {
+		t.Errorf("health = %+v, want healthy", health)
+	}
+}
+
+func TestRefreshLoopRestoreFails(t *testing.T) {
+	login := &fakeLogin{}
+	loop := &refreshLoop{
+		login: login.login,
+		restore: func(context.Context) (time.Time, bool) {
+			return time.Time{}, false
+		},
+		logger: slog.Default(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := loop.run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if login.count() != 1 {
+		t.Errorf("logins = %d, want 1", login.count())
+	}
+}
+
+func TestRefreshLoopStartupTimeout(t *testing.T) {
+	login := &fakeLogin{err: fmt.Errorf("%w: wrong password", ErrBadCredentials)}
+
+	updates := make(chan Health, 1)
+	loop := &refreshLoop{
+		login:          login.login,
+		startupTimeout: time.Millisecond * 100,
+		onHealth: func(health Health) {
+			updates <- health
+		},
+		logger: slog.Default(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	err := loop.run(ctx)
+	if !errors.Is(err, ErrBadCredentials) {
+		t.Fatalf("err = %v, want ErrBadCredentials", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Errorf("returned after %s, want the startup timeout", elapsed)
+	}
+
+	if health := <-updates; health.ConsecutiveFailures != 1 {
+		t.Errorf("health = %+v, want one failure", health)
+	}
+}
+
+func TestRefreshLoopCancelledBeforeSession(t *testing.T) {
+	login := &fakeLogin{err: errors.New("timeout")}
+	loop := &refreshLoop{login: login.login, logger: slog.Default()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	err := loop.run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRefreshLoopLoginNowRecordsHealth(t *testing.T) {
+	login := &fakeLogin{err: fmt.Errorf("%w: wrong password", ErrBadCredentials)}
+
+	updates := make(chan Health, 1)
+	loop := &refreshLoop{
+		login: login.login,
+		onHealth: func(health Health) {
+			updates <- health
+		},
+		logger: slog.Default(),
+	}
+
+	err := loop.loginNow(context.Background())
+	if !errors.Is(err, ErrBadCredentials) {
+		t.Fatalf("err = %v, want ErrBadCredentials", err)
+	}
+
+	health := <-updates
+	if health.ConsecutiveFailures != 1 || !errors.Is(health.LastError, ErrBadCredentials) {
+		t.Errorf("health = %+v, want one failure", health)
+	}
+}
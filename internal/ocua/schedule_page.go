@@ -0,0 +1,206 @@
+package ocua
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/playwright-community/playwright-go"
+)
+
+// Game is a game on a team's schedule
+type Game struct {
+	ID           string    // zuluru game id
+	Start        time.Time // start of the time slot
+	End          time.Time // end of the time slot, zero if it isn't listed
+	OpponentID   string    // zuluru team id, empty if the opponent isn't decided yet
+	OpponentName string
+	FieldName    string // ex: "Brewer Park 2"
+	FieldCode    string // ex: "BRE 2"
+	Home         bool
+}
+
+func GetSchedulePage(ctx context.Context, teamID string, browserContext playwright.BrowserContext) (*bytes.Buffer, error) {
+	return getPageContent(ctx, fmt.Sprintf("/zuluru/teams/schedule?team=%s", teamID), browserContext)
+}
+
+func parseScheduleDate(text string) (time.Time, error) {
+	formats := []string{
+		"Mon Jan 2, 2006", // Format for "Mon Jun 3, 2024"
+		"Jan 2, 2006",     // Format for "Jun 3, 2024"
+		"2006-01-02",
+	}
+
+	for _, format := range formats {
+		date, err := time.ParseInLocation(format, text, time.Local)
+		if err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("failed to parse game date: %q", text)
+}
+
+// parseScheduleTimeSlot returns the start and end of a time slot like
+// "6:45PM-8:15PM" on date. end is zero if the slot only has a start time
+func parseScheduleTimeSlot(date time.Time, text string) (time.Time, time.Time, error) {
+	parseTime := func(text string) (time.Time, error) {
+		t, err := time.Parse("3:04PM", strings.ToUpper(strings.TrimSpace(text)))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse game time: %q", text)
+		}
+		return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, date.Location()), nil
+	}
+
+	startText, endText, hasEnd := strings.Cut(text, "-")
+
+	start, err := parseTime(startText)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if !hasEnd {
+		return start, time.Time{}, nil
+	}
+
+	end, err := parseTime(endText)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return start, end, nil
+}
+
+// queryParam returns a query parameter from the first link in s
+func queryParam(s *goquery.Selection, param string) string {
+	href, ok := s.Find("a").Attr("href")
+	if !ok {
+		return ""
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	return u.Query().Get(param)
+}
+
+// gameID returns the id of the game linked from the row
+func gameID(row *goquery.Selection) string {
+	id := ""
+	row.Find("a").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		u, err := url.Parse(href)
+		if err != nil || !strings.HasSuffix(u.Path, "/games/view") {
+			return true
+		}
+		id = u.Query().Get("game")
+		return id == ""
+	})
+	return id
+}
+
+// scheduleColumns maps the lowercase column headers to their index
+func scheduleColumns(table *goquery.Selection) map[string]int {
+	columns := map[string]int{}
+	table.Find("thead > tr > th").Each(func(i int, s *goquery.Selection) {
+		columns[strings.ToLower(strings.TrimSpace(s.Text()))] = i
+	})
+	return columns
+}
+
+func ParseSchedulePage(page io.Reader) ([]Game, error) {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the table element
+	table := doc.Find("div.teams.schedule").Find("table").First()
+	if table.Length() == 0 {
+		return nil, fmt.Errorf("%w: no schedule table", ErrUnexpectedPage)
+	}
+
+	columns := scheduleColumns(table)
+	for _, column := range []string{"date", "time", "opponent", "location"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("%w: no %s column in the schedule table", ErrUnexpectedPage, column)
+		}
+	}
+
+	games := []Game{}
+
+	rows := table.Find("tbody > tr")
+	for _, node := range rows.Nodes {
+		row := goquery.NewDocumentFromNode(node).Selection
+		cells := row.Find("td")
+		cell := func(column string) *goquery.Selection {
+			return cells.Eq(columns[column])
+		}
+
+		// byes and unscheduled games don't link to a game
+		id := gameID(row)
+		if id == "" {
+			continue
+		}
+
+		date, err := parseScheduleDate(strings.TrimSpace(cell("date").Text()))
+		if err != nil {
+			return nil, err
+		}
+
+		start, end, err := parseScheduleTimeSlot(date, strings.TrimSpace(cell("time").Text()))
+		if err != nil {
+			return nil, err
+		}
+
+		opponent := cell("opponent")
+		field := cell("location")
+
+		fieldName, _ := field.Find("a").Attr("title")
+		fieldCode := strings.TrimSpace(field.Text())
+		if fieldName == "" {
+			fieldName = fieldCode
+		}
+
+		games = append(games, Game{
+			ID:           id,
+			Start:        start,
+			End:          end,
+			OpponentID:   queryParam(opponent, "team"),
+			OpponentName: strings.TrimSpace(opponent.Find("a").First().Text()),
+			FieldName:    fieldName,
+			FieldCode:    fieldCode,
+			Home:         strings.Contains(strings.ToLower(opponent.Text()), "(home)"),
+		})
+	}
+
+	return games, nil
+}
+
+// JoinSchedule returns a copy of weeks with each week's game from games. weeks
+// with only a date match a game on the same day
+func JoinSchedule(weeks []Attendance, games []Game) []Attendance {
+	joined := make([]Attendance, len(weeks))
+	copy(joined, weeks)
+
+	for i, week := range joined {
+		for _, game := range games {
+			sameTime := game.Start.Equal(week.Gametime)
+			sameDay := week.Gametime.Hour() == 0 && week.Gametime.Minute() == 0 && game.Start.Format("2006-01-02") == week.Gametime.Format("2006-01-02")
+
+			if sameTime || sameDay {
+				joined[i].Game = &game
+				break
+			}
+		}
+	}
+
+	return joined
+}
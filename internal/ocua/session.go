@@ -0,0 +1,206 @@
+package ocua
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/playwright-community/playwright-go"
+)
+
+// ErrSessionExpired is returned when a request is redirected to the login page
+var ErrSessionExpired = errors.New("session expired")
+
+// StatusError is returned when OCUA responds with a non-2xx status code
+type StatusError struct {
+	Path       string
+	StatusCode int
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", err.StatusCode, err.Path)
+}
+
+// checkResponse returns an error if the request for path ended on the login
+// page or with a non-2xx status code. finalURL is the url after redirects
+func checkResponse(path string, statusCode int, finalURL string) error {
+	u, err := url.Parse(finalURL)
+	if err == nil && strings.HasPrefix(u.Path, "/user/login") && !strings.HasPrefix(path, "/user/login") {
+		return fmt.Errorf("%w: %s redirected to the login page", ErrSessionExpired, path)
+	}
+
+	if statusCode < 200 || statusCode > 299 {
+		return &StatusError{Path: path, StatusCode: statusCode}
+	}
+
+	return nil
+}
+
+// checkLoggedIn returns an error if the page is the login form. drupal 7 serves
+// the form at /user with a 200 instead of redirecting when there's no session
+func checkLoggedIn(path string, page io.Reader) error {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return err
+	}
+
+	if doc.Find("#edit-pass").Length() > 0 {
+		return fmt.Errorf("%w: %s shows the login form", ErrSessionExpired, path)
+	}
+	return nil
+}
+
+// checkPageResponse is checkResponse for a playwright navigation
+func checkPageResponse(path string, res playwright.Response, page playwright.Page) error {
+	statusCode := http.StatusOK
+	if res != nil {
+		statusCode = res.Status()
+	}
+	return checkResponse(path, statusCode, page.URL())
+}
+
+// newPage opens a page that respects ctx. the deadline becomes the playwright
+// timeout and cancelling ctx closes the page, which fails any pending operation.
+// the returned function closes the page
+func newPage(ctx context.Context, browserContext playwright.BrowserContext) (playwright.Page, func(), error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, err := browserContext.NewPage()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		// playwright treats a timeout of 0 as no timeout
+		timeout := max(float64(time.Until(deadline).Milliseconds()), 1)
+		page.SetDefaultTimeout(timeout)
+		page.SetDefaultNavigationTimeout(timeout)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		page.Close()
+	})
+
+	return page, func() {
+		stop()
+		page.Close()
+	}, nil
+}
+
+// contextError returns the context's error instead of err if the context
+// ended, playwright errors from a closed page don't say why it was closed
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	return err
+}
+
+// getPageContent navigates a new page to path and returns its content
+func getPageContent(ctx context.Context, path string, browserContext playwright.BrowserContext) (*bytes.Buffer, error) {
+	page, closePage, err := newPage(ctx, browserContext)
+	if err != nil {
+		return nil, err
+	}
+	defer closePage()
+
+	res, err := page.Goto(path)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	err = checkPageResponse(path, res, page)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := page.Content()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return bytes.NewBufferString(content), nil
+}
+
+// loginTimeout is how long a background login can take
+const loginTimeout = 2 * time.Minute
+
+// sleepContext sleeps for d, returns false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// needsRefresh returns true if logging in again could fix the error. drupal
+// responds with access denied instead of redirecting on some pages
+func needsRefresh(err error) bool {
+	if errors.Is(err, ErrSessionExpired) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// sessionGuard logs in again when requests find the session expired. requests
+// that notice at the same time share a single login
+type sessionGuard struct {
+	mu        sync.Mutex
+	refreshed time.Time
+}
+
+// refresh logs in unless the session was already refreshed after since
+func (guard *sessionGuard) refresh(ctx context.Context, since time.Time, login func(context.Context) error) error {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	if guard.refreshed.After(since) {
+		return nil
+	}
+
+	err := login(ctx)
+	if err != nil {
+		return err
+	}
+
+	guard.refreshed = time.Now()
+	return nil
+}
+
+// retry runs request, and if the session expired logs in and runs it once more
+func (guard *sessionGuard) retry(ctx context.Context, login func(context.Context) error, request func() error) error {
+	start := time.Now()
+
+	err := request()
+	if !needsRefresh(err) || login == nil {
+		return err
+	}
+
+	refreshErr := guard.refresh(ctx, start, login)
+	if refreshErr != nil {
+		return fmt.Errorf("%w, then failed to login again: %w", err, refreshErr)
+	}
+
+	return request()
+}
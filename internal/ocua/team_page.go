@@ -2,6 +2,7 @@ package ocua
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/url"
@@ -17,22 +18,8 @@ type Player struct {
 	Gender string
 }
 
-func GetTeamPage(teamID string, context playwright.BrowserContext) (*bytes.Buffer, error) {
-	page, err := context.NewPage()
-	if err != nil {
-		return nil, err
-	}
-
-	page.Goto(fmt.Sprintf("/zuluru/teams/view?team=%s", teamID))
-	defer page.Close()
-
-	content, err := page.Content()
-	if err != nil {
-		return nil, err
-	}
-
-	buf := bytes.NewBuffer([]byte(content))
-	return buf, nil
+func GetTeamPage(ctx context.Context, teamID string, browserContext playwright.BrowserContext) (*bytes.Buffer, error) {
+	return getPageContent(ctx, fmt.Sprintf("/zuluru/teams/view?team=%s", teamID), browserContext)
 }
 
 func ParseTeamPage(page io.Reader) (map[string]Player, error) {
@@ -43,6 +30,9 @@ func ParseTeamPage(page io.Reader) (map[string]Player, error) {
 
 	// find the table element
 	body := doc.Find("div.related.row").Find("table.table-striped.table-hover > tbody").First()
+	if body.Length() == 0 {
+		return nil, fmt.Errorf("%w: no roster table", ErrUnexpectedPage)
+	}
 
 	rows := body.Find("tr")
 	rows = rows.Slice(1, rows.Length()-1)